@@ -0,0 +1,136 @@
+// Package cassette records the HTTP traffic between a client and a Proxmox server and replays it in tests.
+//
+// A Recorder sends requests on to the server and writes every interaction to a cassette file. Tickets, CSRF tokens
+// and passwords are scrubbed before anything is written, and the host is dropped so a cassette can be replayed
+// against any URL. A Replayer answers requests from the cassette without a server.
+package cassette
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Mode selects whether a cassette is recorded or replayed
+type Mode int
+
+const (
+	// Replay answers requests from the cassette and fails requests it has no recording for
+	Replay Mode = iota
+	// Record sends requests to the server and writes every interaction to the cassette
+	Record
+)
+
+// Redacted replaces secrets in recorded requests and responses
+const Redacted = "REDACTED"
+
+// sensitiveKeys are the parameters and response fields that are never written to a cassette
+var sensitiveKeys = []string{"password", "new-password", "cipassword", "ticket", "CSRFPreventionToken"}
+
+// sensitiveJSON matches the sensitive fields in a JSON document
+var sensitiveJSON = regexp.MustCompile(`"(` + strings.Join(sensitiveKeys, "|") + `)"(\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// Cassette is a recording of the requests sent to a Proxmox server and the responses it returned
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one request and its response
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request. The URL only holds the path and query.
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// Response is a recorded response. Status holds the full status line, Proxmox puts the reason for errors there.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Load reads a cassette from a file
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Load-read-file: %w", err)
+	}
+
+	cassette := Cassette{}
+	err = json.Unmarshal(data, &cassette)
+	if err != nil {
+		return nil, fmt.Errorf("Load-unmarshal: %w", err)
+	}
+
+	return &cassette, nil
+}
+
+// Save writes the cassette to a file, creating the directory when needed
+func (cassette *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Save-marshal: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("Save-create-directory: %w", err)
+	}
+
+	err = os.WriteFile(path, append(data, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf("Save-write-file: %w", err)
+	}
+
+	return nil
+}
+
+// requestURL returns the part of the URL that is recorded, the host is left out
+func requestURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.EscapedPath()
+	}
+	return u.EscapedPath() + "?" + u.RawQuery
+}
+
+// sanitizeBody removes the secrets from a form or JSON body
+func sanitizeBody(body string, contentType string) string {
+	if body == "" {
+		return body
+	}
+
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(body)
+		if err != nil {
+			return body
+		}
+		for _, key := range sensitiveKeys {
+			if values.Has(key) {
+				values.Set(key, Redacted)
+			}
+		}
+		return values.Encode()
+	}
+
+	return sensitiveJSON.ReplaceAllString(body, `"$1"$2"`+Redacted+`"`)
+}
+
+// sanitizeHeader drops the headers that carry credentials
+func sanitizeHeader(header http.Header) http.Header {
+	sanitized := header.Clone()
+	sanitized.Del("Set-Cookie")
+	sanitized.Del("Date")
+	return sanitized
+}
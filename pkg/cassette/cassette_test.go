@@ -0,0 +1,181 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		switch request.URL.Path {
+		case "/api2/json/access/ticket":
+			_, _ = io.WriteString(writer, `{"data":{"username":"root@pam","ticket":"PVE:root@pam:65A1B2C3::secret","CSRFPreventionToken":"65A1B2C3:csrf"}}`)
+		case "/api2/json/nodes/pve/tasks/UPID/status":
+			polls++
+			if polls < 2 {
+				_, _ = io.WriteString(writer, `{"data":{"status":"running"}}`)
+				return
+			}
+			_, _ = io.WriteString(writer, `{"data":{"status":"stopped","exitstatus":"OK"}}`)
+		default:
+			writer.Header().Set("Set-Cookie", "PVEAuthCookie=secret")
+			_, _ = io.WriteString(writer, `{"data":{"memory":"2048","cores":1}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, client *http.Client, url string) string {
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recording := &http.Client{Transport: NewRecorder(path, nil)}
+
+	response, err := recording.Post(server.URL+"/api2/json/access/ticket", "application/x-www-form-urlencoded", strings.NewReader("username=root%40pam&password=vagrant"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+
+	config := get(t, recording, server.URL+"/api2/json/nodes/pve/qemu/100/config")
+	if config != `{"data":{"memory":"2048","cores":1}}` {
+		t.Errorf("Expected the recorder to pass the response through, got %s", config)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"vagrant", "PVE:root@pam", "csrf", "PVEAuthCookie", server.Listener.Addr().String()} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Expected %q to be scrubbed from the cassette", secret)
+		}
+	}
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaying := &http.Client{Transport: replayer}
+	server.Close()
+
+	// The password is scrubbed before matching, so any password replays the recorded login
+	response, err = replaying.Post("https://proxmox.invalid/api2/json/access/ticket", "application/x-www-form-urlencoded", strings.NewReader("username=root%40pam&password=other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+
+	config = get(t, replaying, "https://proxmox.invalid/api2/json/nodes/pve/qemu/100/config")
+	if config != `{"data":{"memory":"2048","cores":1}}` {
+		t.Errorf("Expected the recorded body to be replayed unchanged, got %s", config)
+	}
+
+	_, err = replaying.Get("https://proxmox.invalid/api2/json/nodes/pve/qemu/101/config")
+	if err == nil {
+		t.Error("Expected a request that was not recorded to fail")
+	}
+}
+
+func TestReplayRepeatsLastResponse(t *testing.T) {
+	server := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recording := &http.Client{Transport: NewRecorder(path, nil)}
+	get(t, recording, server.URL+"/api2/json/nodes/pve/tasks/UPID/status")
+	get(t, recording, server.URL+"/api2/json/nodes/pve/tasks/UPID/status")
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaying := &http.Client{Transport: replayer}
+
+	expected := []string{
+		`{"data":{"status":"running"}}`,
+		`{"data":{"status":"stopped","exitstatus":"OK"}}`,
+		`{"data":{"status":"stopped","exitstatus":"OK"}}`,
+	}
+	for i, body := range expected {
+		actual := get(t, replaying, "https://proxmox.invalid/api2/json/nodes/pve/tasks/UPID/status")
+		if actual != body {
+			t.Errorf("Poll %d: expected %s, got %s", i, body, actual)
+		}
+	}
+}
+
+func TestReplayLeavesRequestAlone(t *testing.T) {
+	server := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recording := &http.Client{Transport: NewRecorder(path, nil)}
+	response, err := recording.Post(server.URL+"/api2/json/nodes/pve/qemu", "application/json", strings.NewReader(`{"vmid":100}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := http.NewRequest("POST", "https://proxmox.invalid/api2/json/nodes/pve/qemu", strings.NewReader(`{"vmid":100}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	body := request.Body
+
+	response, err = replayer.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+
+	if request.Body != body {
+		t.Error("Expected the body of the request to be left alone")
+	}
+}
+
+func TestSanitizeBody(t *testing.T) {
+	tests := []struct {
+		body        string
+		contentType string
+		expected    string
+	}{
+		{`{"cipassword":"secret","name":"vm"}`, "application/json", `{"cipassword":"REDACTED","name":"vm"}`},
+		{`{"data":{"ticket" : "PVE:a\"b","cap":{}}}`, "application/json", `{"data":{"ticket" : "REDACTED","cap":{}}}`},
+		{"password=secret&username=root%40pam", "application/x-www-form-urlencoded", "password=REDACTED&username=root%40pam"},
+		{`{"memory":2048}`, "application/json", `{"memory":2048}`},
+	}
+
+	for _, test := range tests {
+		actual := sanitizeBody(test.body, test.contentType)
+		if actual != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Recorder is an http.RoundTripper that sends requests with the wrapped transport and records them in a cassette.
+// The cassette file is written after every interaction, so there is nothing to flush when the test ends.
+type Recorder struct {
+	path      string
+	transport http.RoundTripper
+
+	mutex    sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder records to the cassette file at path. When transport is nil http.DefaultTransport is used.
+func NewRecorder(path string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &Recorder{path: path, transport: transport}
+}
+
+// RoundTrip sends the request and records the sanitized request and response
+func (recorder *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	// Send a copy, a RoundTripper must not modify the request it is given
+	outgoing := request.Clone(request.Context())
+	requestBody, err := readBody(&outgoing.Body)
+	if err != nil {
+		return nil, fmt.Errorf("RoundTrip-read-request: %w", err)
+	}
+
+	response, err := recorder.transport.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := readBody(&response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("RoundTrip-read-response: %w", err)
+	}
+
+	interaction := Interaction{
+		Request: Request{
+			Method: request.Method,
+			URL:    requestURL(request.URL),
+			Body:   sanitizeBody(requestBody, request.Header.Get("Content-Type")),
+		},
+		Response: Response{
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Header:     sanitizeHeader(response.Header),
+			Body:       sanitizeBody(responseBody, response.Header.Get("Content-Type")),
+		},
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.cassette.Interactions = append(recorder.cassette.Interactions, interaction)
+
+	err = recorder.cassette.Save(recorder.path)
+	if err != nil {
+		return nil, fmt.Errorf("RoundTrip-save: %w", err)
+	}
+
+	return response, nil
+}
+
+// readBody reads the body and replaces it with a copy, so it can still be sent or returned
+func readBody(body *io.ReadCloser) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+
+	data, err := io.ReadAll(*body)
+	if err != nil {
+		return "", err
+	}
+
+	err = (*body).Close()
+	if err != nil {
+		return "", err
+	}
+
+	*body = io.NopCloser(bytes.NewReader(data))
+	return string(data), nil
+}
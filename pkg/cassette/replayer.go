@@ -0,0 +1,84 @@
+package cassette
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Replayer is an http.RoundTripper that answers requests from a cassette.
+// Requests are matched on their method, path, query and sanitized body. Identical requests get the recorded responses
+// in order, and once those run out the last one is repeated, so polling for a task settles on its final status.
+type Replayer struct {
+	mutex    sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// NewReplayer replays the cassette file at path
+func NewReplayer(path string) (*Replayer, error) {
+	cassette, err := Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("NewReplayer-load: %w", err)
+	}
+
+	return &Replayer{cassette: cassette, used: make([]bool, len(cassette.Interactions))}, nil
+}
+
+// RoundTrip returns the recorded response for the request
+func (replayer *Replayer) RoundTrip(request *http.Request) (*http.Response, error) {
+	// Read the body of a copy, a RoundTripper must not modify the request it is given
+	incoming := request.Clone(request.Context())
+	body, err := readBody(&incoming.Body)
+	if err != nil {
+		return nil, fmt.Errorf("RoundTrip-read-request: %w", err)
+	}
+
+	recorded := Request{
+		Method: request.Method,
+		URL:    requestURL(request.URL),
+		Body:   sanitizeBody(body, request.Header.Get("Content-Type")),
+	}
+
+	replayer.mutex.Lock()
+	defer replayer.mutex.Unlock()
+
+	last := -1
+	for i, interaction := range replayer.cassette.Interactions {
+		if interaction.Request != recorded {
+			continue
+		}
+		last = i
+		if !replayer.used[i] {
+			replayer.used[i] = true
+			return interaction.Response.httpResponse(request), nil
+		}
+	}
+
+	if last == -1 {
+		return nil, fmt.Errorf("cassette has no recording of %s %s", recorded.Method, recorded.URL)
+	}
+
+	return replayer.cassette.Interactions[last].Response.httpResponse(request), nil
+}
+
+func (response Response) httpResponse(request *http.Request) *http.Response {
+	header := response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        response.Status,
+		StatusCode:    response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(response.Body)),
+		ContentLength: int64(len(response.Body)),
+		Request:       request,
+	}
+}
@@ -0,0 +1,88 @@
+package cloudinit
+
+import (
+	"testing"
+)
+
+func TestIPConfigRoundTrip(t *testing.T) {
+	data := "gw=192.168.1.1,gw6=2001:db8::1,ip=192.168.1.10/24,ip6=2001:db8::10/64"
+
+	config := &IPConfig{}
+	err := UnmarshalIPConfig(1, data, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ID != 1 || *config.IP != "192.168.1.10/24" || *config.Gateway != "192.168.1.1" || *config.IP6 != "2001:db8::10/64" {
+		t.Errorf("Expected a static IPv4 and IPv6 configuration, got %+v", config)
+	}
+
+	marshalled, err := MarshalIPConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != data {
+		t.Errorf("Expected %q, got %q", data, marshalled)
+	}
+}
+
+func TestIPConfigMarshalDHCP(t *testing.T) {
+	dhcp := DHCP
+	auto := Auto
+	marshalled, err := MarshalIPConfig(&IPConfig{ID: 0, IP: &dhcp, IP6: &auto})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != "ip=dhcp,ip6=auto" {
+		t.Errorf("Expected ip=dhcp,ip6=auto, got %q", marshalled)
+	}
+
+	gateway := "192.168.1.1"
+	_, err = MarshalIPConfig(&IPConfig{ID: 0, IP: &dhcp, Gateway: &gateway})
+	if err == nil {
+		t.Error("Expected an error for a gateway with DHCP")
+	}
+
+	_, err = MarshalIPConfig(&IPConfig{ID: 32, IP: &dhcp})
+	if err == nil {
+		t.Error("Expected an error for ipconfig32")
+	}
+}
+
+func TestSSHKeysRoundTrip(t *testing.T) {
+	keys := []string{
+		"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIB+/x= user@host",
+		"ssh-rsa AAAAB3NzaC1yc2E= other@host",
+	}
+
+	encoded := EncodeSSHKeys(keys)
+	expected := "ssh-ed25519%20AAAAC3NzaC1lZDI1NTE5AAAAIB%2B%2Fx%3D%20user%40host%0Assh-rsa%20AAAAB3NzaC1yc2E%3D%20other%40host"
+	if encoded != expected {
+		t.Errorf("Expected %q, got %q", expected, encoded)
+	}
+
+	decoded, err := DecodeSSHKeys(encoded + "%0A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != 2 || decoded[0] != keys[0] || decoded[1] != keys[1] {
+		t.Errorf("Expected %q, got %q", keys, decoded)
+	}
+}
+
+func TestIsDrive(t *testing.T) {
+	for data, expected := range map[string]bool{
+		"local-lvm:vm-100-cloudinit,media=cdrom":       true,
+		"local:100/vm-100-cloudinit.qcow2,media=cdrom": true,
+		"local-lvm:vm-100-disk-0,size=8G":              false,
+		"local:iso/cloudinit.iso,media=cdrom":          false,
+		"none,media=cdrom":                             false,
+	} {
+		if IsDrive(data) != expected {
+			t.Errorf("Expected IsDrive(%q) to be %v", data, expected)
+		}
+	}
+}
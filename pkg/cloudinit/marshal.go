@@ -0,0 +1,110 @@
+package cloudinit
+
+import (
+	"fmt"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// driveVolume matches the volume Proxmox allocates for the cloud-init drive, local-lvm:vm-100-cloudinit on block
+// storage and local:100/vm-100-cloudinit.qcow2 on directory storage
+var driveVolume = regexp.MustCompile(`^[^:]+:(\d+/)?vm-\d+-cloudinit(\.\w+)?$`)
+
+// DriveSetting matches the settings that can hold the cloud-init drive
+var DriveSetting = regexp.MustCompile(`^(ide[0-3]|sata[0-5]|scsi([0-9]|[12][0-9]|30))$`)
+
+// properties is the property string Proxmox uses for IP configurations
+type properties struct {
+	Gateway  *string `prop:"gw"`
+	Gateway6 *string `prop:"gw6"`
+	IP       *string `prop:"ip"`
+	IP6      *string `prop:"ip6"`
+}
+
+func UnmarshalIPConfig(id int64, data string, config *IPConfig) error {
+	if data == "" {
+		return nil
+	}
+
+	parsed := properties{}
+	err := propstring.Unmarshal(data, &parsed)
+	if err != nil {
+		return fmt.Errorf("invalid IP configuration %v: %w", id, err)
+	}
+
+	config.ID = id
+	config.IP = parsed.IP
+	config.Gateway = parsed.Gateway
+	config.IP6 = parsed.IP6
+	config.Gateway6 = parsed.Gateway6
+
+	return nil
+}
+
+func MarshalIPConfig(config *IPConfig) (string, error) {
+
+	if config == nil {
+		return "", fmt.Errorf("cannot marshal nil IPConfig object")
+	}
+
+	if config.ID < 0 || config.ID > MaxIPConfigID {
+		return "", fmt.Errorf("invalid ID for IP configuration: %v", config.ID)
+	}
+
+	if config.Gateway != nil && config.IP != nil && *config.IP == DHCP {
+		return "", fmt.Errorf("invalid IP configuration %v: a gateway cannot be used with DHCP", config.ID)
+	}
+
+	if config.Gateway6 != nil && config.IP6 != nil && (*config.IP6 == DHCP || *config.IP6 == Auto) {
+		return "", fmt.Errorf("invalid IP configuration %v: an IPv6 gateway cannot be used with %s", config.ID, *config.IP6)
+	}
+
+	data, err := propstring.Marshal(properties{
+		Gateway:  config.Gateway,
+		Gateway6: config.Gateway6,
+		IP:       config.IP,
+		IP6:      config.IP6,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid IP configuration %v: %w", config.ID, err)
+	}
+
+	return data, nil
+}
+
+// EncodeSSHKeys encodes the keys the way Proxmox expects sshkeys, one key per line, percent-encoded like
+// encodeURIComponent in JavaScript. Proxmox rejects keys where spaces are encoded as a plus sign.
+func EncodeSSHKeys(keys []string) string {
+	encoded := url.QueryEscape(strings.Join(keys, "\n"))
+	return strings.ReplaceAll(encoded, "+", "%20")
+}
+
+// DecodeSSHKeys decodes the sshkeys setting into one key per entry, empty lines are left out
+func DecodeSSHKeys(data string) ([]string, error) {
+	decoded, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH keys: %w", err)
+	}
+
+	keys := []string{}
+	for _, key := range strings.Split(decoded, "\n") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// IsDrive reports whether the disk setting is a cloud-init drive, for example local-lvm:vm-100-cloudinit,media=cdrom
+func IsDrive(data string) bool {
+	volume, _, _ := strings.Cut(data, ",")
+	return driveVolume.MatchString(volume)
+}
+
+// DriveValue is the value that adds a cloud-init drive on the storage
+func DriveValue(storage string) string {
+	return storage + ":cloudinit"
+}
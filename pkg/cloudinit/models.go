@@ -0,0 +1,43 @@
+package cloudinit
+
+// MaxIPConfigID is the highest IP configuration number, VMs have ipconfig0 to ipconfig31, one for each network device
+const MaxIPConfigID = 31
+
+// DHCP configures an address with DHCP, it can be used for both IP and IP6
+const DHCP = "dhcp"
+
+// Auto configures an IPv6 address with SLAAC
+const Auto = "auto"
+
+// CloudInit holds the settings Proxmox passes to the guest through the cloud-init drive.
+// Settings that are nil are not changed, settings set to an empty string are removed.
+type CloudInit struct {
+	User *string // ciuser, the user to create instead of the default user of the image
+	// Password is cipassword. Proxmox never returns the password, so it is nil when read.
+	Password     *string
+	SSHKeys      *[]string // sshkeys, the public keys of the user, one per entry
+	Nameserver   *string   // DNS servers, separated by spaces
+	SearchDomain *string
+	// Custom is cicustom, snippets that replace the generated configuration, for example user=local:snippets/user.yaml
+	Custom *string
+	// IPConfigs are ipconfig0 to ipconfig31. When updating, configurations that are not in the list are removed.
+	IPConfigs *[]IPConfig
+	// Drive is the CD-ROM drive Proxmox writes the cloud-init image to. When updating, a Drive without a storage
+	// removes it.
+	Drive *Drive
+}
+
+// IPConfig is the IP configuration of a network device, the ipconfigN setting for netN
+type IPConfig struct {
+	ID       int64
+	IP       *string // IPv4 address in CIDR notation, or DHCP
+	Gateway  *string // IPv4 gateway
+	IP6      *string // IPv6 address in CIDR notation, DHCP or Auto
+	Gateway6 *string // IPv6 gateway
+}
+
+// Drive is the cloud-init drive of a VM
+type Drive struct {
+	Setting string // The setting holding the drive, for example ide2, scsi1 or sata0
+	Storage string
+}
@@ -0,0 +1,46 @@
+package efidisk
+
+import (
+	"testing"
+)
+
+func TestEfiDiskRoundTrip(t *testing.T) {
+	data := "local-lvm:vm-100-disk-1,efitype=4m,pre-enrolled-keys=1,size=4M"
+
+	efiDisk := &Disk{}
+	err := Unmarshal(data, efiDisk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if efiDisk.Storage != "local-lvm" || *efiDisk.Path != "vm-100-disk-1" || *efiDisk.EFIType != "4m" || !*efiDisk.PreEnrolledKeys {
+		t.Errorf("Expected a 4m EFI disk with pre-enrolled keys, got %+v", efiDisk)
+	}
+
+	marshalled, err := Marshal(efiDisk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != data {
+		t.Errorf("Expected %q, got %q", data, marshalled)
+	}
+}
+
+func TestEfiDiskMarshalAllocation(t *testing.T) {
+	efiType := "4m"
+	marshalled, err := Marshal(&Disk{Storage: "local-lvm", EFIType: &efiType})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != "local-lvm:1,efitype=4m" {
+		t.Errorf("Expected local-lvm:1,efitype=4m, got %q", marshalled)
+	}
+
+	efiType = "8m"
+	_, err = Marshal(&Disk{Storage: "local-lvm", EFIType: &efiType})
+	if err == nil {
+		t.Error("Expected an error for an unknown EFI type")
+	}
+}
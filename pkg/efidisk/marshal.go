@@ -0,0 +1,71 @@
+package efidisk
+
+import (
+	"fmt"
+	"github.com/clincha-org/proxmox-api/pkg/internal/disk"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+)
+
+// properties is the property string Proxmox uses for EFI disks
+type properties struct {
+	File            string            `prop:"file,default"`
+	EFIType         *string           `prop:"efitype,enum=2m|4m"`
+	Format          *string           `prop:"format,enum=raw|qcow2|vmdk|cloop|cow|qcow|qed|vpc"`
+	PreEnrolledKeys *bool             `prop:"pre-enrolled-keys"`
+	Size            *propstring.Size  `prop:"size"`
+	Extra           map[string]string `prop:",extra"`
+}
+
+func Unmarshal(data string, efiDisk *Disk) error {
+	if data == "" {
+		return nil
+	}
+
+	parsed := properties{}
+	err := propstring.Unmarshal(data, &parsed)
+	if err != nil {
+		return fmt.Errorf("invalid EFI disk: %w", err)
+	}
+
+	efiDisk.Storage, efiDisk.Path = disk.SplitFile(parsed.File)
+	efiDisk.Format = parsed.Format
+	efiDisk.EFIType = parsed.EFIType
+	efiDisk.PreEnrolledKeys = parsed.PreEnrolledKeys
+	efiDisk.Size = parsed.Size
+	efiDisk.Extra = parsed.Extra
+
+	return nil
+}
+
+func Marshal(efiDisk *Disk) (string, error) {
+
+	if efiDisk == nil {
+		return "", fmt.Errorf("cannot marshal nil Disk object")
+	}
+
+	if efiDisk.Storage == "" {
+		return "", fmt.Errorf("storage is required for the EFI disk")
+	}
+
+	parsed := properties{
+		EFIType:         efiDisk.EFIType,
+		Format:          efiDisk.Format,
+		PreEnrolledKeys: efiDisk.PreEnrolledKeys,
+		Extra:           efiDisk.Extra,
+	}
+
+	// Proxmox picks the size of a new EFI disk itself, the size in STORAGE:SIZE is ignored
+	if efiDisk.Path == nil {
+		parsed.File = efiDisk.Storage + ":1"
+	} else {
+		parsed.File = efiDisk.Storage + ":" + *efiDisk.Path
+		parsed.Size = efiDisk.Size
+	}
+
+	data, err := propstring.Marshal(parsed)
+	if err != nil {
+		return "", fmt.Errorf("invalid EFI disk: %w", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,20 @@
+package efidisk
+
+import (
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+)
+
+// Disk is the EFI disk of a VM, the efidisk0 setting, which holds the UEFI variables of VMs using the ovmf bios
+type Disk struct {
+	Storage string
+	// Path is the volume on the storage. Leave it nil to allocate a new volume.
+	Path    *string
+	Format  *string // raw, qcow2 or vmdk
+	EFIType *string // 2m or 4m, Secure Boot requires 4m
+	// PreEnrolledKeys enrolls the distribution and Microsoft keys, which enables Secure Boot
+	PreEnrolledKeys *bool
+	// Size is set by Proxmox, it is not used when allocating the volume
+	Size *propstring.Size
+	// Extra holds the options this model does not cover, so they survive a round trip
+	Extra map[string]string
+}
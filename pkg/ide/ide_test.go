@@ -15,3 +15,82 @@ func TestIdeMarshal(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestIdeRoundTrip(t *testing.T) {
+	tests := []string{
+		"local:iso/" + UbuntuTestIso + ",media=cdrom,size=2690412K",
+		"local-lvm:vm-102-disk-0,size=4G",
+		"none,media=cdrom",
+	}
+
+	for _, data := range tests {
+		device := &InternalDataStorage{}
+		err := Unmarshal(1, data, device)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshalled, err := Marshal(device)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if marshalled != data {
+			t.Errorf("Expected %q, got %q", data, marshalled)
+		}
+	}
+}
+
+func TestIdeRoundTripExtra(t *testing.T) {
+	data := "local-lvm:vm-102-disk-0,cache=writeback,format=raw,size=4G,ssd=1"
+
+	device := &InternalDataStorage{}
+	err := Unmarshal(0, data, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if device.Extra["cache"] != "writeback" || device.Extra["format"] != "raw" || device.Extra["ssd"] != "1" {
+		t.Errorf("Expected the options the model does not cover to be kept, got %v", device.Extra)
+	}
+
+	marshalled, err := Marshal(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Options the model does not cover are written after the ones it does
+	expected := "local-lvm:vm-102-disk-0,size=4G,cache=writeback,format=raw,ssd=1"
+	if marshalled != expected {
+		t.Errorf("Expected %q, got %q", expected, marshalled)
+	}
+}
+
+func TestIdeUnknownMedia(t *testing.T) {
+	device := InternalDataStorage{}
+	err := Unmarshal(2, "local:iso/"+UbuntuTestIso+",media=floppy", &device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *device.Media != "floppy" {
+		t.Errorf("Expected the unknown media type to be kept, got %q", *device.Media)
+	}
+
+	_, err = Marshal(&device)
+	if err == nil {
+		t.Error("Expected an error for an unknown media type")
+	}
+}
+
+func TestIdeMarshalAllocation(t *testing.T) {
+	size := "4"
+	marshalled, err := Marshal(&InternalDataStorage{ID: 1, Storage: "local-lvm", Size: &size})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != "local-lvm:4" {
+		t.Errorf("Expected local-lvm:4, got %q", marshalled)
+	}
+}
@@ -2,32 +2,41 @@ package ide
 
 import (
 	"fmt"
-	"log/slog"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
 	"strings"
 )
 
+// properties is the property string Proxmox uses for IDE devices
+type properties struct {
+	File  string            `prop:"file,default"`
+	Media *string           `prop:"media,enum=cdrom|disk"`
+	Size  *string           `prop:"size"`
+	Extra map[string]string `prop:",extra"`
+}
+
 func Unmarshal(id int64, data string, storage *InternalDataStorage) error {
 	if data == "" {
 		return nil
 	}
-	commaSeparated := strings.Split(data, ",")
 
-	slog.Debug("ide-unmarshal", "data", data)
+	device := properties{}
+	err := propstring.Unmarshal(data, &device)
+	if err != nil {
+		return fmt.Errorf("invalid IDE device %v: %w", id, err)
+	}
 
 	storage.ID = id
+	storage.Media = device.Media
+	storage.Size = device.Size
+	storage.Extra = device.Extra
 
-	storage.Storage = strings.Split(commaSeparated[0], ":")[0]
-	storage.Path = &strings.Split(commaSeparated[0], ":")[1]
-
-	for _, value := range commaSeparated[1:] {
-		keyValue := strings.Split(value, "=")
-		switch keyValue[0] {
-		case "media":
-			storage.Media = &keyValue[1]
-		case "size":
-			storage.Size = &keyValue[1]
-		}
+	// Volumes are written as STORAGE:PATH, an empty drive is just none
+	storageID, path, found := strings.Cut(device.File, ":")
+	storage.Storage = storageID
+	if found {
+		storage.Path = &path
 	}
+
 	return nil
 }
 
@@ -45,20 +54,28 @@ func Marshal(storage *InternalDataStorage) (string, error) {
 		return "", fmt.Errorf("storage is required for IDE device: %v", storage.ID)
 	}
 
-	var data string
+	// An empty CD-ROM drive has no volume, it is just none
+	if storage.Storage == "none" {
+		media := "cdrom"
+		if storage.Media != nil {
+			media = *storage.Media
+		}
+		return propstring.Marshal(properties{File: "none", Media: &media, Extra: storage.Extra})
+	}
+
 	// Handle special syntax STORAGE_ID:SIZE_IN_GiB to allocate a new volume. See Proxmox API documentation.
 	if storage.Path == nil && storage.Size != nil {
 		return storage.Storage + ":" + *storage.Size, nil
 	}
 
-	data = storage.Storage + ":" + *storage.Path
-
-	if storage.Media != nil {
-		data += ",media=" + *storage.Media
-	}
-	if storage.Size != nil {
-		data += ",size=" + *storage.Size
+	if storage.Path == nil {
+		return "", fmt.Errorf("path or size is required for IDE device: %v", storage.ID)
 	}
 
-	return data, nil
+	return propstring.Marshal(properties{
+		File:  storage.Storage + ":" + *storage.Path,
+		Media: storage.Media,
+		Size:  storage.Size,
+		Extra: storage.Extra,
+	})
 }
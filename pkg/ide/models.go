@@ -6,4 +6,6 @@ type InternalDataStorage struct {
 	Path    *string
 	Media   *string
 	Size    *string
+	// Extra holds the options this model does not cover, so they survive a round trip
+	Extra map[string]string
 }
@@ -0,0 +1,57 @@
+// Package disk holds the helpers shared by the SCSI, VirtIO and SATA disk packages
+package disk
+
+import (
+	"errors"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+	"strconv"
+	"strings"
+)
+
+// File returns the volume of the disk. When the path is not set the STORAGE:SIZE syntax is used to allocate a new
+// volume of the size, rounded up to whole GiB, and the returned bool is true.
+func File(storage string, path *string, size *propstring.Size) (string, bool, error) {
+	if storage == "" {
+		return "", false, errors.New("storage is required")
+	}
+
+	if path != nil {
+		return storage + ":" + *path, false, nil
+	}
+
+	if size == nil {
+		return "", false, errors.New("path or size is required")
+	}
+
+	return storage + ":" + strconv.FormatInt(size.Gibibytes(), 10), true, nil
+}
+
+// SplitFile splits the volume into the storage and the path, the path is nil for volumes without one such as none
+func SplitFile(file string) (string, *string) {
+	storage, path, found := strings.Cut(file, ":")
+	if !found {
+		return storage, nil
+	}
+	return storage, &path
+}
+
+// Discard converts the discard option to a boolean, Proxmox uses on and ignore
+func Discard(discard *string) *bool {
+	if discard == nil {
+		return nil
+	}
+	enabled := *discard == "on"
+	return &enabled
+}
+
+// DiscardOption converts a boolean to the discard option
+func DiscardOption(enabled *bool) *string {
+	if enabled == nil {
+		return nil
+	}
+	option := "ignore"
+	if *enabled {
+		option = "on"
+	}
+	return &option
+}
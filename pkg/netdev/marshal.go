@@ -0,0 +1,108 @@
+package netdev
+
+import (
+	"fmt"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+	"slices"
+)
+
+// properties is the property string Proxmox uses for network devices.
+// Proxmox writes the model as the key of the MAC address, virtio=BC:24:11:2F:5E:01, which ends up in Extra.
+type properties struct {
+	Model    *string           `prop:"model"`
+	MAC      *string           `prop:"macaddr"`
+	Bridge   *string           `prop:"bridge"`
+	Firewall *bool             `prop:"firewall"`
+	LinkDown *bool             `prop:"link_down"`
+	MTU      *int64            `prop:"mtu"`
+	Queues   *int64            `prop:"queues"`
+	Rate     *float64          `prop:"rate"`
+	Tag      *int64            `prop:"tag"`
+	Trunks   *[]int64          `prop:"trunks"`
+	Extra    map[string]string `prop:",extra"`
+}
+
+func Unmarshal(id int64, data string, device *NetworkDevice) error {
+	if data == "" {
+		return nil
+	}
+
+	parsed := properties{}
+	err := propstring.Unmarshal(data, &parsed)
+	if err != nil {
+		return fmt.Errorf("invalid network device %v: %w", id, err)
+	}
+
+	device.ID = id
+	device.MAC = parsed.MAC
+	device.Bridge = parsed.Bridge
+	device.Tag = parsed.Tag
+	device.Trunks = parsed.Trunks
+	device.Firewall = parsed.Firewall
+	device.Rate = parsed.Rate
+	device.MTU = parsed.MTU
+	device.Queues = parsed.Queues
+	device.LinkDown = parsed.LinkDown
+
+	if parsed.Model != nil {
+		device.Model = *parsed.Model
+	}
+
+	for _, model := range Models {
+		mac, found := parsed.Extra[model]
+		if !found {
+			continue
+		}
+		device.Model = model
+		if mac != "" {
+			device.MAC = &mac
+		}
+	}
+
+	if device.Model == "" {
+		return fmt.Errorf("model is missing from network device %v: %q", id, data)
+	}
+
+	return nil
+}
+
+func Marshal(device *NetworkDevice) (string, error) {
+
+	if device == nil {
+		return "", fmt.Errorf("cannot marshal nil NetworkDevice object")
+	}
+
+	if device.ID < 0 || device.ID > MaxID {
+		return "", fmt.Errorf("invalid ID for network device: %v", device.ID)
+	}
+
+	if !slices.Contains(Models, device.Model) {
+		return "", fmt.Errorf("invalid model for network device %v: %q", device.ID, device.Model)
+	}
+
+	options, err := propstring.Marshal(properties{
+		Bridge:   device.Bridge,
+		Firewall: device.Firewall,
+		LinkDown: device.LinkDown,
+		MTU:      device.MTU,
+		Queues:   device.Queues,
+		Rate:     device.Rate,
+		Tag:      device.Tag,
+		Trunks:   device.Trunks,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid network device %v: %w", device.ID, err)
+	}
+
+	// Write the model and MAC address the same way Proxmox does
+	data := "model=" + device.Model
+	if device.MAC != nil {
+		data = device.Model + "=" + *device.MAC
+	}
+
+	if options != "" {
+		data += "," + options
+	}
+
+	return data, nil
+}
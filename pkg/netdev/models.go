@@ -0,0 +1,25 @@
+package netdev
+
+// Models are the network card models QEMU can emulate
+var Models = []string{
+	"e1000", "e1000-82540em", "e1000-82544gc", "e1000-82545em", "e1000e", "i82551", "i82557b", "i82559er",
+	"ne2k_isa", "ne2k_pci", "pcnet", "rtl8139", "virtio", "vmxnet3",
+}
+
+// MaxID is the highest network device number, VMs have net0 to net31
+const MaxID = 31
+
+// NetworkDevice is a network card of a VM, the netN setting
+type NetworkDevice struct {
+	ID       int64
+	Model    string
+	MAC      *string // Generated by Proxmox when not set
+	Bridge   *string
+	Tag      *int64   // VLAN tag
+	Trunks   *[]int64 // VLAN trunks passed through the interface
+	Firewall *bool
+	Rate     *float64 // Rate limit in MB/s
+	MTU      *int64   // Only for virtio, 1 uses the MTU of the bridge
+	Queues   *int64   // Packet queues, only for virtio
+	LinkDown *bool
+}
@@ -0,0 +1,87 @@
+package netdev
+
+import (
+	"testing"
+)
+
+func TestNetworkDeviceUnmarshal(t *testing.T) {
+	device := &NetworkDevice{}
+	err := Unmarshal(0, "virtio=BC:24:11:2F:5E:01,bridge=vmbr0,firewall=1,link_down=0,mtu=1,queues=4,rate=12.5,tag=10,trunks=20;30", device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if device.Model != "virtio" || *device.MAC != "BC:24:11:2F:5E:01" {
+		t.Errorf("Expected virtio with MAC BC:24:11:2F:5E:01, got %q and %v", device.Model, device.MAC)
+	}
+
+	if *device.Bridge != "vmbr0" || !*device.Firewall || *device.LinkDown {
+		t.Errorf("Expected vmbr0 with the firewall enabled and the link up, got %+v", device)
+	}
+
+	if *device.Tag != 10 || len(*device.Trunks) != 2 || *device.Rate != 12.5 || *device.Queues != 4 || *device.MTU != 1 {
+		t.Errorf("Expected the numeric options to be read, got %+v", device)
+	}
+}
+
+func TestNetworkDeviceRoundTrip(t *testing.T) {
+	tests := []string{
+		"virtio=BC:24:11:2F:5E:01,bridge=vmbr0,firewall=1",
+		"e1000=BC:24:11:2F:5E:02,bridge=vmbr1,link_down=1,tag=20,trunks=30;40",
+	}
+
+	for _, data := range tests {
+		device := &NetworkDevice{}
+		err := Unmarshal(1, data, device)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshalled, err := Marshal(device)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if marshalled != data {
+			t.Errorf("Expected %q, got %q", data, marshalled)
+		}
+	}
+}
+
+func TestNetworkDeviceMarshalWithoutMAC(t *testing.T) {
+	bridge := "vmbr0"
+	marshalled, err := Marshal(&NetworkDevice{ID: 0, Model: "virtio", Bridge: &bridge})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != "model=virtio,bridge=vmbr0" {
+		t.Errorf("Expected model=virtio,bridge=vmbr0, got %q", marshalled)
+	}
+
+	device := &NetworkDevice{}
+	err = Unmarshal(0, marshalled, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Model != "virtio" || device.MAC != nil {
+		t.Errorf("Expected virtio without a MAC address, got %q and %v", device.Model, device.MAC)
+	}
+}
+
+func TestNetworkDeviceInvalid(t *testing.T) {
+	_, err := Marshal(&NetworkDevice{ID: 32, Model: "virtio"})
+	if err == nil {
+		t.Error("Expected an error for net32")
+	}
+
+	_, err = Marshal(&NetworkDevice{ID: 0, Model: "token-ring"})
+	if err == nil {
+		t.Error("Expected an error for an unknown model")
+	}
+
+	err = Unmarshal(0, "bridge=vmbr0", &NetworkDevice{})
+	if err == nil {
+		t.Error("Expected an error for a device without a model")
+	}
+}
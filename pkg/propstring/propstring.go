@@ -0,0 +1,431 @@
+// Package propstring encodes and decodes Proxmox property strings, the comma separated option lists Proxmox uses
+// for disks, network devices and many other settings, for example:
+//
+//	local-lvm:vm-100-disk-0,cache=writeback,discard=on,size=32G
+//
+// The keys are taken from the prop struct tag, which works like the json tag:
+//
+//	type Disk struct {
+//		File    string  `prop:"file,default"`
+//		Cache   *string `prop:"cache,enum=none|writethrough|writeback|unsafe|directsync"`
+//		Discard *bool   `prop:"discard"`
+//		Size    *propstring.Size `prop:"size"`
+//		Extra   map[string]string `prop:",extra"`
+//	}
+//
+// The tag options are:
+//   - default: the value may be written without its key. It is always written first and without its key.
+//   - omitempty: a zero value is left out. Nil pointers, slices and maps are always left out.
+//   - enum=a|b|c: the value must be one of the listed values when encoding. Other values are kept when decoding.
+//   - extra: a map[string]string that collects the keys no other field has, so they survive a round trip.
+//
+// Booleans are written as 1 and 0 and read from 1, 0, on, off, yes, no, true and false. Slices are separated by
+// semicolons. Values containing commas, quotes or backslashes are quoted. Fields implementing encoding.TextMarshaler
+// and encoding.TextUnmarshaler, such as Size, encode themselves. Keys that are not known, and there is no extra
+// field for, are ignored when decoding.
+package propstring
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type field struct {
+	index     int
+	key       string
+	isDefault bool
+	omitEmpty bool
+	enum      []string
+}
+
+type fields struct {
+	list  []field
+	extra int // index of the extra field, -1 when there is none
+}
+
+var (
+	textMarshaler   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func typeFields(t reflect.Type) (fields, error) {
+	result := fields{extra: -1}
+
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+
+		tag := structField.Tag.Get("prop")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		f := field{index: i, key: name}
+		if f.key == "" {
+			f.key = strings.ToLower(structField.Name)
+		}
+
+		isExtra := false
+		if options != "" {
+			for _, option := range strings.Split(options, ",") {
+				switch {
+				case option == "default":
+					f.isDefault = true
+				case option == "omitempty":
+					f.omitEmpty = true
+				case option == "extra":
+					isExtra = true
+				case strings.HasPrefix(option, "enum="):
+					f.enum = strings.Split(strings.TrimPrefix(option, "enum="), "|")
+				default:
+					return result, fmt.Errorf("unknown option %q in the prop tag of %s.%s", option, t.Name(), structField.Name)
+				}
+			}
+		}
+
+		if isExtra {
+			if structField.Type != reflect.TypeOf(map[string]string{}) {
+				return result, fmt.Errorf("the extra field %s.%s must be a map[string]string", t.Name(), structField.Name)
+			}
+			result.extra = i
+			continue
+		}
+
+		if f.isDefault && slices.ContainsFunc(result.list, func(other field) bool { return other.isDefault }) {
+			return result, fmt.Errorf("%s has more than one default key", t.Name())
+		}
+
+		result.list = append(result.list, f)
+	}
+
+	return result, nil
+}
+
+// Marshal encodes a struct, or a pointer to one, as a property string
+func Marshal(v any) (string, error) {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return "", errors.New("cannot marshal a nil pointer")
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return "", fmt.Errorf("cannot marshal %s, only structs can be marshalled", value.Type())
+	}
+
+	fields, err := typeFields(value.Type())
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, f := range fields.list {
+		fieldValue := value.Field(f.index)
+
+		if isNil(fieldValue) || (f.omitEmpty && fieldValue.IsZero()) {
+			continue
+		}
+
+		text, err := encodeValue(fieldValue)
+		if err != nil {
+			return "", fmt.Errorf("cannot marshal %s: %w", f.key, err)
+		}
+
+		if f.enum != nil && !slices.Contains(f.enum, text) {
+			return "", fmt.Errorf("invalid value %q for %s, expected one of %s", text, f.key, strings.Join(f.enum, ", "))
+		}
+
+		if f.isDefault {
+			parts = append([]string{quote(text)}, parts...)
+			continue
+		}
+		parts = append(parts, f.key+"="+quote(text))
+	}
+
+	if fields.extra != -1 {
+		extra := value.Field(fields.extra).Interface().(map[string]string)
+		keys := make([]string, 0, len(extra))
+		for key := range extra {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			parts = append(parts, key+"="+quote(extra[key]))
+		}
+	}
+
+	return strings.Join(parts, ","), nil
+}
+
+// Unmarshal decodes the property string into the struct v points to.
+// Fields whose keys are not in the property string are left unchanged.
+func Unmarshal(data string, v any) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot unmarshal into %T, a pointer to a struct is required", v)
+	}
+	value = value.Elem()
+
+	fields, err := typeFields(value.Type())
+	if err != nil {
+		return err
+	}
+
+	parts, err := split(data)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		key, text, found := cutUnquoted(part, '=')
+		if !found {
+			index := slices.IndexFunc(fields.list, func(f field) bool { return f.isDefault })
+			if index == -1 {
+				return fmt.Errorf("value %q has no key and %s has no default key", part, value.Type().Name())
+			}
+			key, text = fields.list[index].key, part
+		}
+
+		text, err = unquote(text)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+
+		index := slices.IndexFunc(fields.list, func(f field) bool { return f.key == key })
+		if index == -1 {
+			if fields.extra != -1 {
+				extra := value.Field(fields.extra)
+				if extra.IsNil() {
+					extra.Set(reflect.MakeMap(extra.Type()))
+				}
+				extra.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(text))
+			}
+			continue
+		}
+
+		// Enums are not checked, so values added by newer Proxmox releases can still be read
+		f := fields.list[index]
+		err = decodeValue(text, value.Field(f.index))
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", text, f.key, err)
+		}
+	}
+
+	return nil
+}
+
+// Equal reports whether two property strings hold the same options. The order of the keys is ignored, Proxmox writes
+// them in its own order which is not always the order they were sent in.
+func Equal(a, b string) bool {
+	partsA, err := split(a)
+	if err != nil {
+		return a == b
+	}
+	partsB, err := split(b)
+	if err != nil {
+		return a == b
+	}
+
+	slices.Sort(partsA)
+	slices.Sort(partsB)
+	return slices.Equal(partsA, partsB)
+}
+
+func isNil(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
+
+func encodeValue(value reflect.Value) (string, error) {
+	if value.Type().Implements(textMarshaler) {
+		text, err := value.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer:
+		return encodeValue(value.Elem())
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Bool:
+		if value.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64), nil
+	case reflect.Slice:
+		elements := make([]string, value.Len())
+		for i := range elements {
+			text, err := encodeValue(value.Index(i))
+			if err != nil {
+				return "", err
+			}
+			elements[i] = text
+		}
+		return strings.Join(elements, ";"), nil
+	}
+
+	return "", fmt.Errorf("unsupported type %s", value.Type())
+}
+
+func decodeValue(text string, value reflect.Value) error {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return decodeValue(text, value.Elem())
+	}
+
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshaler) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		parsed, err := parseBool(text)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(text, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(text, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(text, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		elements := strings.Split(text, ";")
+		slice := reflect.MakeSlice(value.Type(), len(elements), len(elements))
+		for i, element := range elements {
+			err := decodeValue(element, slice.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+
+	return nil
+}
+
+func parseBool(text string) (bool, error) {
+	switch strings.ToLower(text) {
+	case "1", "on", "yes", "true":
+		return true, nil
+	case "0", "off", "no", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not a boolean", text)
+}
+
+// split separates the property string at the commas that are not inside quotes
+func split(data string) ([]string, error) {
+	var parts []string
+	var current strings.Builder
+	quoted, escaped := false, false
+
+	for _, r := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+			}
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", data)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+
+	return parts, nil
+}
+
+// cutUnquoted cuts the part at the first separator that is not inside quotes
+func cutUnquoted(part string, separator byte) (string, string, bool) {
+	quoted := false
+	for i := 0; i < len(part); i++ {
+		switch {
+		case part[i] == '"':
+			quoted = !quoted
+		case part[i] == separator && !quoted:
+			return part[:i], part[i+1:], true
+		}
+	}
+	return "", part, false
+}
+
+// quote quotes values that would otherwise be split or misread
+func quote(text string) string {
+	if !strings.ContainsAny(text, ",\"\\") {
+		return text
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
+
+func unquote(text string) (string, error) {
+	if !strings.HasPrefix(text, `"`) {
+		return text, nil
+	}
+	if len(text) < 2 || !strings.HasSuffix(text, `"`) {
+		return "", fmt.Errorf("unterminated quote in %q", text)
+	}
+
+	var unquoted strings.Builder
+	escaped := false
+	for _, r := range text[1 : len(text)-1] {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		unquoted.WriteRune(r)
+	}
+
+	return unquoted.String(), nil
+}
@@ -0,0 +1,166 @@
+package propstring
+
+import (
+	"testing"
+)
+
+type testDisk struct {
+	File    string            `prop:"file,default"`
+	Cache   *string           `prop:"cache,enum=none|writethrough|writeback|unsafe|directsync"`
+	SSD     *bool             `prop:"ssd"`
+	Size    *Size             `prop:"size"`
+	Trunks  []int64           `prop:"trunks"`
+	Serial  *string           `prop:"serial"`
+	Queues  int64             `prop:"queues,omitempty"`
+	Ignored string            `prop:"-"`
+	Extra   map[string]string `prop:",extra"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	disk := testDisk{}
+	err := Unmarshal(`local-lvm:vm-100-disk-0,cache=writeback,ssd=on,size=32G,trunks=10;20,serial="a,\"b\"",aio=native`, &disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if disk.File != "local-lvm:vm-100-disk-0" {
+		t.Errorf("Expected the default key to be read, got %q", disk.File)
+	}
+	if *disk.Cache != "writeback" {
+		t.Errorf("Expected writeback, got %q", *disk.Cache)
+	}
+	if !*disk.SSD {
+		t.Error("Expected ssd to be true")
+	}
+	if *disk.Size != 32*Gibibyte {
+		t.Errorf("Expected 32G, got %v", *disk.Size)
+	}
+	if len(disk.Trunks) != 2 || disk.Trunks[1] != 20 {
+		t.Errorf("Expected trunks 10 and 20, got %v", disk.Trunks)
+	}
+	if *disk.Serial != `a,"b"` {
+		t.Errorf("Expected the quoted value to be unquoted, got %q", *disk.Serial)
+	}
+	if disk.Extra["aio"] != "native" {
+		t.Errorf("Expected the unknown key to be kept, got %v", disk.Extra)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	cache := "none"
+	ssd := false
+	size := 2690412 * Kibibyte
+	serial := `a,"b"`
+	disk := testDisk{
+		Cache:   &cache,
+		SSD:     &ssd,
+		Size:    &size,
+		Trunks:  []int64{10, 20},
+		Serial:  &serial,
+		File:    "local:iso/ubuntu.iso",
+		Ignored: "ignored",
+		Extra:   map[string]string{"media": "cdrom", "aio": "native"},
+	}
+
+	marshalled, err := Marshal(disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `local:iso/ubuntu.iso,cache=none,ssd=0,size=2690412K,trunks=10;20,serial="a,\"b\"",aio=native,media=cdrom`
+	if marshalled != expected {
+		t.Errorf("Expected %s, got %s", expected, marshalled)
+	}
+
+	roundTrip := testDisk{}
+	err = Unmarshal(marshalled, &roundTrip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *roundTrip.Serial != serial || *roundTrip.Size != size {
+		t.Errorf("Expected the values to survive a round trip, got %+v", roundTrip)
+	}
+}
+
+func TestEnum(t *testing.T) {
+	// Values from newer Proxmox releases are kept when decoding
+	disk := testDisk{}
+	err := Unmarshal("local-lvm:vm-100-disk-0,cache=fast", &disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *disk.Cache != "fast" {
+		t.Errorf("Expected the unknown cache value to be kept, got %q", *disk.Cache)
+	}
+
+	cache := "fast"
+	_, err = Marshal(testDisk{File: "local-lvm:8", Cache: &cache})
+	if err == nil {
+		t.Error("Expected an error for a value that is not in the enum")
+	}
+}
+
+func TestNoDefaultKey(t *testing.T) {
+	type startup struct {
+		Order *int64 `prop:"order"`
+		Up    *int64 `prop:"up"`
+	}
+
+	value := startup{}
+	err := Unmarshal("order=1,up=30", &value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *value.Order != 1 || *value.Up != 30 {
+		t.Errorf("Expected order 1 and up 30, got %v and %v", *value.Order, *value.Up)
+	}
+
+	err = Unmarshal("1,up=30", &value)
+	if err == nil {
+		t.Error("Expected an error for a value without a key")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	// Proxmox writes the keys of the extra map in alphabetical order, between the other keys
+	if !Equal("local-lvm:vm-100-disk-0,cache=writeback,size=8G,snapshot=1", "local-lvm:vm-100-disk-0,cache=writeback,snapshot=1,size=8G") {
+		t.Error("Expected the order of the keys to be ignored")
+	}
+
+	if Equal("local-lvm:vm-100-disk-0,size=8G", "local-lvm:vm-100-disk-0,size=16G") {
+		t.Error("Expected a changed value to be different")
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		text     string
+		size     Size
+		expected string
+	}{
+		{"32G", 32 * Gibibyte, "32G"},
+		{"2690412K", 2690412 * Kibibyte, "2690412K"},
+		{"4M", 4 * Mebibyte, "4M"},
+		{"1024M", Gibibyte, "1G"},
+		{"1.5G", 1536 * Mebibyte, "1536M"},
+		{"512", 512, "512"},
+	}
+
+	for _, test := range tests {
+		size, err := ParseSize(test.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != test.size {
+			t.Errorf("Expected %s to be %d bytes, got %d", test.text, test.size, size)
+		}
+		if size.String() != test.expected {
+			t.Errorf("Expected %s to be written as %s, got %s", test.text, test.expected, size.String())
+		}
+	}
+
+	_, err := ParseSize("large")
+	if err == nil {
+		t.Error("Expected an error for an invalid size")
+	}
+}
@@ -0,0 +1,74 @@
+package propstring
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Size is a disk or memory size in bytes, written the way Proxmox writes sizes, for example 32G or 2690412K
+type Size int64
+
+const (
+	Kibibyte Size = 1 << (10 * (iota + 1))
+	Mebibyte
+	Gibibyte
+	Tebibyte
+)
+
+var sizeUnits = []struct {
+	suffix string
+	size   Size
+}{
+	{"T", Tebibyte},
+	{"G", Gibibyte},
+	{"M", Mebibyte},
+	{"K", Kibibyte},
+}
+
+// ParseSize parses a size with an optional K, M, G or T suffix. A size without a suffix is in bytes.
+func ParseSize(text string) (Size, error) {
+	number, unit := text, Size(1)
+	for _, u := range sizeUnits {
+		if trimmed, found := strings.CutSuffix(strings.ToUpper(text), u.suffix); found {
+			number, unit = trimmed, u.size
+			break
+		}
+	}
+
+	parsed, err := strconv.ParseFloat(number, 64)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid size %q", text)
+	}
+
+	return Size(math.Round(parsed * float64(unit))), nil
+}
+
+// String writes the size in the largest unit that holds it exactly
+func (size Size) String() string {
+	for _, u := range sizeUnits {
+		if size != 0 && size%u.size == 0 {
+			return strconv.FormatInt(int64(size/u.size), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(size), 10)
+}
+
+// Gibibytes returns the size in whole GiB, rounded up, which is the unit Proxmox allocates new disks in
+func (size Size) Gibibytes() int64 {
+	return int64((size + Gibibyte - 1) / Gibibyte)
+}
+
+func (size Size) MarshalText() ([]byte, error) {
+	return []byte(size.String()), nil
+}
+
+func (size *Size) UnmarshalText(text []byte) error {
+	parsed, err := ParseSize(string(text))
+	if err != nil {
+		return err
+	}
+	*size = parsed
+	return nil
+}
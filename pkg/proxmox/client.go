@@ -1,7 +1,7 @@
 package proxmox
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,8 +9,8 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,24 +18,46 @@ const DefaultHostURL string = "https://localhost:8006"
 const ApiPath string = "/api2/json/"
 const AuthenticationTicketPath string = "access/ticket"
 
-type Client struct {
-	Host       string
-	Username   string
-	Password   string
-	HTTPClient *http.Client
-	Ticket     *Ticket
-}
+// TicketLifetime is how long Proxmox accepts an authentication ticket after it has been issued.
+const TicketLifetime = 2 * time.Hour
+
+// ticketRenewalMargin is how long before the ticket expires that the client logs in again.
+const ticketRenewalMargin = 15 * time.Minute
 
-func NewClient(Host string, Username string, Password string, LogLevel slog.Level) (*Client, error) {
+// DefaultTimeout is the timeout of the HTTP client created by NewClient when no HTTP client or timeout is given
+const DefaultTimeout = 10 * time.Second
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: LogLevel}))
-	slog.SetDefault(logger)
+type Client struct {
+	Host        string
+	Username    string
+	Password    string
+	TokenID     string
+	TokenSecret string
+	UserAgent   string
+	HTTPClient  *http.Client
+	Logger      *slog.Logger
+	RetryPolicy RetryPolicy
+	Ticket      *Ticket
+	// TicketIssued is when the current Ticket was issued, used to renew the ticket before it expires
+	TicketIssued time.Time
+
+	ticketMutex sync.RWMutex
+	tlsSettings *tlsSettings
+	cassette    *cassetteSettings
+	timeout     *time.Duration
+}
 
+// NewClient creates a client for the Proxmox server at Host.
+// An authentication option, WithTicketAuth or WithAPIToken, is required. Ticket clients log in before NewClient returns.
+// The certificate of the server is verified against the system certificate pool unless TLS options are given.
+func NewClient(Host string, options ...ClientOption) (*Client, error) {
 	client := Client{
 		HTTPClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout: DefaultTimeout,
 		},
-		Host: DefaultHostURL,
+		Logger:      slog.Default(),
+		RetryPolicy: DefaultRetryPolicy,
+		Host:        DefaultHostURL,
 	}
 
 	if Host == "" {
@@ -43,41 +65,55 @@ func NewClient(Host string, Username string, Password string, LogLevel slog.Leve
 	}
 	client.Host = Host
 
-	if Username == "" || Password == "" {
-		return &client, fmt.Errorf("NewClient-Username-Password: %w", errors.New("username and password are required"))
-	} else {
-		client.Username = Username
-		client.Password = Password
+	err := client.applyOptions(options)
+	if err != nil {
+		return &client, fmt.Errorf("NewClient-options: %w", err)
+	}
+
+	if client.TokenID == "" && client.Username == "" {
+		return &client, fmt.Errorf("NewClient-authentication: %w", errors.New("WithTicketAuth or WithAPIToken is required"))
 	}
 
-	ticket, err := client.Login()
+	if client.TokenID != "" && client.Username != "" {
+		return &client, fmt.Errorf("NewClient-authentication: %w", errors.New("WithTicketAuth and WithAPIToken cannot be used together"))
+	}
+
+	// API tokens are sent with every request, so there is nothing to log in to
+	if client.TokenID != "" {
+		return &client, nil
+	}
+
+	ticket, err := client.Login(context.Background())
 	if err != nil {
 		return &client, fmt.Errorf("NewClient-Login: %w", err)
 	}
 
 	client.Ticket = ticket
+	client.TicketIssued = time.Now()
 
 	return &client, nil
 }
 
-func (client *Client) Login() (*Ticket, error) {
+func (client *Client) Login(ctx context.Context) (*Ticket, error) {
 	var ticket = Ticket{}
 
 	authPayload := url.Values{}
 	authPayload.Add("username", client.Username)
 	authPayload.Add("password", client.Password)
 
-	client.HTTPClient.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	}
-
-	response, err := client.HTTPClient.Post(
+	request, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
 		client.Host+ApiPath+AuthenticationTicketPath,
-		"application/x-www-form-urlencoded",
 		strings.NewReader(authPayload.Encode()),
 	)
+	if err != nil {
+		return &ticket, fmt.Errorf("Login-build-request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := client.roundTrip(request)
 	if err != nil {
 		return &ticket, fmt.Errorf("Login-do-request: %w", err)
 	}
@@ -93,7 +129,7 @@ func (client *Client) Login() (*Ticket, error) {
 	}
 
 	if response.StatusCode != http.StatusOK {
-		return &ticket, fmt.Errorf("Login-status-error: %s %s", response.Status, body)
+		return &ticket, fmt.Errorf("Login-status-error: %w", newAPIError(request.Method, AuthenticationTicketPath, response, body))
 	}
 
 	err = json.Unmarshal(body, &ticket)
@@ -103,3 +139,113 @@ func (client *Client) Login() (*Ticket, error) {
 
 	return &ticket, nil
 }
+
+// send authenticates the request and sends it to the Proxmox server.
+// Ticket clients renew their ticket shortly before it expires, and when the server still answers with
+// 401 Unauthorized the ticket is renewed and the request is sent one more time.
+func (client *Client) send(request *http.Request) (*http.Response, error) {
+	if client.TokenID != "" {
+		client.authenticate(request, nil)
+		return client.roundTrip(request)
+	}
+
+	ticket, err := client.validTicket(request.Context())
+	if err != nil {
+		return nil, fmt.Errorf("send-valid-ticket: %w", err)
+	}
+
+	client.authenticate(request, ticket)
+
+	response, err := client.roundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// The body of the request has already been read, so we can only retry if it can be read again
+	if response.StatusCode != http.StatusUnauthorized || (request.Body != nil && request.GetBody == nil) {
+		return response, nil
+	}
+
+	_, _ = io.Copy(io.Discard, response.Body)
+	err = response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("send-close-unauthorized-response: %w", err)
+	}
+
+	client.Logger.Debug("ticket-rejected", "method", request.Method, "url", request.URL.String())
+
+	ticket, err = client.renewTicket(request.Context(), ticket)
+	if err != nil {
+		return nil, fmt.Errorf("send-renew-ticket: %w", err)
+	}
+
+	retry := request.Clone(request.Context())
+	if request.GetBody != nil {
+		retry.Body, err = request.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("send-get-body: %w", err)
+		}
+	}
+	retry.Header.Del("Cookie")
+	client.authenticate(retry, ticket)
+
+	return client.roundTrip(retry)
+}
+
+// roundTrip sends the request with the HTTP client, adding the user agent when one is configured
+func (client *Client) roundTrip(request *http.Request) (*http.Response, error) {
+	if client.UserAgent != "" {
+		request.Header.Set("User-Agent", client.UserAgent)
+	}
+
+	return client.HTTPClient.Do(request)
+}
+
+// validTicket returns the current ticket, logging in again first if the ticket is about to expire.
+func (client *Client) validTicket(ctx context.Context) (*Ticket, error) {
+	client.ticketMutex.RLock()
+	ticket := client.Ticket
+	issued := client.TicketIssued
+	client.ticketMutex.RUnlock()
+
+	if time.Since(issued) < TicketLifetime-ticketRenewalMargin {
+		return ticket, nil
+	}
+
+	return client.renewTicket(ctx, ticket)
+}
+
+// renewTicket logs in again and replaces the stale ticket.
+// When several requests find the same stale ticket at once only the first one logs in, the others reuse its ticket.
+func (client *Client) renewTicket(ctx context.Context, stale *Ticket) (*Ticket, error) {
+	client.ticketMutex.Lock()
+	defer client.ticketMutex.Unlock()
+
+	if client.Ticket != stale {
+		return client.Ticket, nil
+	}
+
+	ticket, err := client.Login(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("renewTicket-login: %w", err)
+	}
+
+	client.Ticket = ticket
+	client.TicketIssued = time.Now()
+
+	client.Logger.Debug("ticket-renewed", "username", client.Username)
+
+	return ticket, nil
+}
+
+// authenticate adds the credentials of the client to the request.
+// API token clients send the PVEAPIToken authorization header, ticket clients send the ticket cookie and CSRF token.
+func (client *Client) authenticate(request *http.Request, ticket *Ticket) {
+	if client.TokenID != "" {
+		request.Header.Set("Authorization", "PVEAPIToken="+client.TokenID+"="+client.TokenSecret)
+		return
+	}
+
+	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: ticket.Data.Ticket})
+	request.Header.Set("CSRFPreventionToken", ticket.Data.CSRFPreventionToken)
+}
@@ -0,0 +1,273 @@
+package proxmox
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/clincha-org/proxmox-api/pkg/cassette"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ClientOption configures a Client while it is being created
+type ClientOption func(client *Client) error
+
+// WithTicketAuth logs in with the username and password and authenticates requests with the ticket Proxmox returns.
+// The username includes the realm, for example root@pam.
+func WithTicketAuth(username string, password string) ClientOption {
+	return func(client *Client) error {
+		if username == "" || password == "" {
+			return errors.New("username and password are required")
+		}
+		client.Username = username
+		client.Password = password
+		return nil
+	}
+}
+
+// WithAPIToken authenticates every request with a Proxmox API token instead of a ticket.
+// The tokenID is the full token identifier in the form user@realm!tokenid.
+func WithAPIToken(tokenID string, secret string) ClientOption {
+	return func(client *Client) error {
+		if tokenID == "" || secret == "" {
+			return errors.New("token ID and token secret are required")
+		}
+		client.TokenID = tokenID
+		client.TokenSecret = secret
+		return nil
+	}
+}
+
+// WithLogger sets the logger the client writes its debug output to. By default the client uses slog.Default().
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(client *Client) error {
+		if logger == nil {
+			return errors.New("logger is required")
+		}
+		client.Logger = logger
+		return nil
+	}
+}
+
+// WithHTTPClient sends requests with the HTTP client instead of the one NewClient creates.
+// The HTTP client is copied before the timeout or TLS options are applied, so it is never modified.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(client *Client) error {
+		if httpClient == nil {
+			return errors.New("HTTP client is required")
+		}
+		client.HTTPClient = httpClient
+		return nil
+	}
+}
+
+// WithTimeout sets the time limit for each request made by the HTTP client, see http.Client.Timeout.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(client *Client) error {
+		client.timeout = &timeout
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) ClientOption {
+	return func(client *Client) error {
+		client.UserAgent = userAgent
+		return nil
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy. Use RetryPolicy{MaxAttempts: 1} to disable retries.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(client *Client) error {
+		client.RetryPolicy = policy
+		return nil
+	}
+}
+
+// tlsSettings collects the TLS options so the transport can be configured once all options have been applied
+type tlsSettings struct {
+	rootCAs     *x509.CertPool
+	fingerprint []byte
+	insecure    bool
+}
+
+// WithCABundle verifies the certificate of the Proxmox server against the PEM encoded certificates in the bundle
+// instead of the system certificate pool.
+func WithCABundle(pem []byte) ClientOption {
+	return func(client *Client) error {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in CA bundle")
+		}
+		client.tlsOptions().rootCAs = pool
+		return nil
+	}
+}
+
+// WithCertificateFingerprint pins the SHA-256 fingerprint of the certificate presented by the Proxmox server.
+// The fingerprint uses the same format as Node.SslFingerprint, for example "AB:CD:...", and the colons are optional.
+// When no CA bundle is supplied the certificate chain is not verified, only the fingerprint.
+func WithCertificateFingerprint(fingerprint string) ClientOption {
+	return func(client *Client) error {
+		decoded, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+		if err != nil {
+			return fmt.Errorf("invalid certificate fingerprint %q: %w", fingerprint, err)
+		}
+		if len(decoded) != sha256.Size {
+			return fmt.Errorf("invalid certificate fingerprint %q: expected %d bytes, got %d", fingerprint, sha256.Size, len(decoded))
+		}
+		client.tlsOptions().fingerprint = decoded
+		return nil
+	}
+}
+
+// WithInsecureSkipVerify disables verification of the certificate presented by the Proxmox server.
+// Only use this against test servers such as the Vagrant boxes, which use self-signed certificates.
+func WithInsecureSkipVerify() ClientOption {
+	return func(client *Client) error {
+		client.tlsOptions().insecure = true
+		return nil
+	}
+}
+
+// cassetteSettings holds the WithCassette option until the transport it wraps has been configured
+type cassetteSettings struct {
+	path string
+	mode cassette.Mode
+}
+
+// WithCassette records the traffic of the client to the cassette file at path, or replays it from there without
+// contacting the server. Tickets, CSRF tokens and passwords are scrubbed from recordings. See the cassette package.
+func WithCassette(path string, mode cassette.Mode) ClientOption {
+	return func(client *Client) error {
+		if path == "" {
+			return errors.New("cassette path is required")
+		}
+		if mode != cassette.Record && mode != cassette.Replay {
+			return fmt.Errorf("unknown cassette mode %d", mode)
+		}
+		client.cassette = &cassetteSettings{path: path, mode: mode}
+		return nil
+	}
+}
+
+func (client *Client) tlsOptions() *tlsSettings {
+	if client.tlsSettings == nil {
+		client.tlsSettings = &tlsSettings{}
+	}
+	return client.tlsSettings
+}
+
+// applyOptions applies the options to the client and then configures the HTTP client for the timeout, TLS and cassette
+// options. A transport the caller has already set up is only changed when TLS options are given, and a cassette
+// recorder wraps the transport once TLS has been configured.
+func (client *Client) applyOptions(options []ClientOption) error {
+	for _, option := range options {
+		err := option(client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if client.timeout == nil && client.tlsSettings == nil && client.cassette == nil {
+		return nil
+	}
+
+	// Work on a copy so an HTTP client passed in with WithHTTPClient is left untouched
+	httpClient := *client.HTTPClient
+	client.HTTPClient = &httpClient
+
+	if client.timeout != nil {
+		client.HTTPClient.Timeout = *client.timeout
+	}
+
+	if client.tlsSettings != nil {
+		err := client.configureTLS()
+		if err != nil {
+			return err
+		}
+	}
+
+	if client.cassette != nil {
+		return client.configureCassette()
+	}
+
+	return nil
+}
+
+// configureTLS replaces the transport of the HTTP client with one using the TLS options
+func (client *Client) configureTLS() error {
+	var transport *http.Transport
+	switch configured := client.HTTPClient.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = configured.Clone()
+	default:
+		return fmt.Errorf("TLS options require an *http.Transport, got %T", configured)
+	}
+
+	transport.TLSClientConfig = client.tlsSettings.config()
+	client.HTTPClient.Transport = transport
+
+	return nil
+}
+
+// configureCassette wraps the transport of the HTTP client in a cassette recorder, or replaces it with a replayer
+func (client *Client) configureCassette() error {
+	if client.cassette.mode == cassette.Record {
+		client.HTTPClient.Transport = cassette.NewRecorder(client.cassette.path, client.HTTPClient.Transport)
+		return nil
+	}
+
+	replayer, err := cassette.NewReplayer(client.cassette.path)
+	if err != nil {
+		return fmt.Errorf("configureCassette-replayer: %w", err)
+	}
+	client.HTTPClient.Transport = replayer
+
+	return nil
+}
+
+// config builds the TLS configuration for the settings
+func (settings *tlsSettings) config() *tls.Config {
+	config := &tls.Config{
+		RootCAs:            settings.rootCAs,
+		InsecureSkipVerify: settings.insecure,
+	}
+
+	if settings.fingerprint != nil {
+		// A pinned certificate is trusted on its own unless a CA bundle was also supplied
+		if settings.rootCAs == nil {
+			config.InsecureSkipVerify = true
+		}
+		fingerprint := settings.fingerprint
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			actual := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if !strings.EqualFold(hex.EncodeToString(actual[:]), hex.EncodeToString(fingerprint)) {
+				return fmt.Errorf("certificate fingerprint mismatch: got %s", FormatFingerprint(actual[:]))
+			}
+			return nil
+		}
+	}
+
+	return config
+}
+
+// FormatFingerprint formats a certificate fingerprint the same way Proxmox does in Node.SslFingerprint
+func FormatFingerprint(fingerprint []byte) string {
+	parts := make([]string, len(fingerprint))
+	for i, b := range fingerprint {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,205 @@
+package proxmox
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/pem"
+	"github.com/clincha-org/proxmox-api/pkg/cassette"
+	"github.com/clincha-org/proxmox-api/pkg/proxmoxtest"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertificateVerifiedByDefault(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	t.Cleanup(server.Close)
+
+	_, err := NewClient(server.URL, WithTicketAuth(TestUsername, TestPassword), WithLogger(testLogger))
+	if err == nil {
+		t.Error("Expected the self-signed certificate to be rejected")
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	t.Cleanup(server.Close)
+
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	_, err := NewClient(server.URL, WithTicketAuth(TestUsername, TestPassword), WithLogger(testLogger), WithCABundle(bundle))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidCABundle(t *testing.T) {
+	_, err := NewClient(DefaultHostURL, WithTicketAuth(TestUsername, TestPassword), WithLogger(testLogger), WithCABundle([]byte("not a certificate")))
+	if err == nil {
+		t.Error("Expected an invalid CA bundle to be rejected")
+	}
+}
+
+func TestCertificateFingerprint(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	t.Cleanup(server.Close)
+
+	fingerprint := sha256.Sum256(server.Certificate().Raw)
+
+	_, err := NewClient(server.URL, WithTicketAuth(TestUsername, TestPassword), WithLogger(testLogger), WithCertificateFingerprint(FormatFingerprint(fingerprint[:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateFingerprintMismatch(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	t.Cleanup(server.Close)
+
+	fingerprint := sha256.Sum256([]byte("another certificate"))
+
+	_, err := NewClient(server.URL, WithTicketAuth(TestUsername, TestPassword), WithLogger(testLogger), WithCertificateFingerprint(FormatFingerprint(fingerprint[:])))
+	if err == nil {
+		t.Error("Expected a certificate with a different fingerprint to be rejected")
+	}
+}
+
+func TestInvalidCertificateFingerprint(t *testing.T) {
+	_, err := NewClient(DefaultHostURL, WithTicketAuth(TestUsername, TestPassword), WithLogger(testLogger), WithCertificateFingerprint("AB:CD"))
+	if err == nil {
+		t.Error("Expected a short fingerprint to be rejected")
+	}
+}
+
+func TestAuthenticationRequired(t *testing.T) {
+	_, err := NewClient(DefaultHostURL, WithLogger(testLogger))
+	if err == nil {
+		t.Error("Expected an error when no authentication option is given")
+	}
+}
+
+func TestOnlyOneAuthenticationMethod(t *testing.T) {
+	_, err := NewClient(DefaultHostURL, WithTicketAuth(TestUsername, TestPassword), WithAPIToken("root@pam!ci", "secret"))
+	if err == nil {
+		t.Error("Expected an error when both authentication options are given")
+	}
+}
+
+func TestLoggerOption(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	t.Cleanup(server.Close)
+
+	defaultLogger := slog.Default()
+
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	client, err := NewClient(server.URL, WithTicketAuth(TestUsername, TestPassword), WithLogger(logger), WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An expired ticket makes the client log the renewal
+	client.TicketIssued = time.Now().Add(-TicketLifetime)
+	_, err = client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slog.Default() != defaultLogger {
+		t.Error("Expected the default logger to be left alone")
+	}
+
+	if !strings.Contains(output.String(), "ticket-renewed") {
+		t.Errorf("Expected the client to log through the given logger, got %q", output.String())
+	}
+}
+
+func TestHTTPClientOption(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	t.Cleanup(server.Close)
+
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	httpClient := &http.Client{Transport: transport}
+
+	client, err := NewClient(server.URL, WithTicketAuth(TestUsername, TestPassword), WithHTTPClient(httpClient), WithTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.HTTPClient.Transport != transport {
+		t.Error("Expected the transport of the HTTP client to be used as is")
+	}
+
+	if client.HTTPClient.Timeout != time.Minute {
+		t.Errorf("Expected a timeout of one minute, got %v", client.HTTPClient.Timeout)
+	}
+
+	if httpClient.Timeout != 0 {
+		t.Error("Expected the HTTP client passed in to be left alone")
+	}
+}
+
+func TestUserAgentOption(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	defer server.Close()
+
+	server.OnRequest(func(request *http.Request, params map[string]any) {
+		if request.UserAgent() != "terraform-provider-proxmox" {
+			t.Errorf("Expected the configured user agent, got %q", request.UserAgent())
+		}
+	})
+
+	client, err := NewClient(server.URL, WithTicketAuth(TestUsername, TestPassword), WithUserAgent("terraform-provider-proxmox"), WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithCassette(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	path := filepath.Join(t.TempDir(), "nodes.json")
+
+	client, err := NewClient(server.URL, WithTicketAuth(TestUsername, TestPassword), WithLogger(testLogger), WithHTTPClient(server.Client()), WithCassette(path, cassette.Record))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+
+	client, err = NewClient(server.URL, WithTicketAuth(TestUsername, TestPassword), WithLogger(testLogger), WithCassette(path, cassette.Replay))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replayed) != 1 || replayed[0].SslFingerprint != recorded[0].SslFingerprint {
+		t.Errorf("Expected the recorded nodes %+v, got %+v", recorded, replayed)
+	}
+}
+
+func TestWithCassetteMissing(t *testing.T) {
+	_, err := NewClient(DefaultHostURL, WithTicketAuth(TestUsername, TestPassword), WithCassette(filepath.Join(t.TempDir(), "missing.json"), cassette.Replay))
+	if err == nil {
+		t.Error("Expected an error for a cassette that does not exist")
+	}
+}
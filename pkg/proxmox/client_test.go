@@ -1,19 +1,95 @@
 package proxmox
 
 import (
+	"context"
+	"errors"
+	"github.com/clincha-org/proxmox-api/pkg/cassette"
+	"github.com/clincha-org/proxmox-api/pkg/proxmoxtest"
 	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 const TestUsername = "root@pam"
 const TestPassword = "vagrant"
 
-func TestLogin(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
+var testLogger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+// testHost returns the Proxmox server to test against and the options to connect to it.
+// Tests run against the in-process fake unless PROXMOX_TEST_HOST points them at a real server, such as a Vagrant box.
+func testHost(t *testing.T) (string, []ClientOption) {
+	if host := os.Getenv("PROXMOX_TEST_HOST"); host != "" {
+		return host, []ClientOption{WithLogger(testLogger), WithInsecureSkipVerify()}
+	}
+
+	server := proxmoxtest.NewServer()
+	t.Cleanup(server.Close)
+
+	return server.URL, []ClientOption{WithLogger(testLogger), WithHTTPClient(server.Client())}
+}
+
+// newCassetteClient returns a client replaying the cassette testdata/<name>.json, a recording of a real server.
+// Until the cassette has been recorded the hand-written fixture testdata/synthetic/<name>.json is replayed instead.
+// With PROXMOX_RECORD set the cassette is recorded from the real server in the environment variable hostVariable,
+// after fixture has set up the server with a client that is not recorded. PROXMOX_RECORD=proxmox-8 only records the
+// cassettes in that directory, so each version can be recorded on its own.
+func newCassetteClient(t *testing.T, name string, hostVariable string, fixture func(t *testing.T, client *Client)) *Client {
+	path := filepath.Join("testdata", name+".json")
+
+	if record := os.Getenv("PROXMOX_RECORD"); record != "" && (record == "1" || strings.HasPrefix(name, record+"/")) {
+		host := os.Getenv(hostVariable)
+		if host == "" {
+			t.Fatalf("Recording %s requires %s to point at a real Proxmox server", name, hostVariable)
+		}
+
+		options := []ClientOption{WithLogger(testLogger), WithInsecureSkipVerify()}
+		fixture(t, newClientWith(t, host, options))
+
+		return newClientWith(t, host, append(options, WithCassette(path, cassette.Record)))
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		path = filepath.Join("testdata", "synthetic", name+".json")
+	}
+
+	return newClientWith(t, "https://proxmox.invalid:8006", []ClientOption{WithLogger(testLogger), WithCassette(path, cassette.Replay)})
+}
+
+// newClientWith returns a client logged in to the host as TestUsername
+func newClientWith(t *testing.T, host string, options []ClientOption) *Client {
+
+	client, err := NewClient(host, append(options, WithTicketAuth(TestUsername, TestPassword))...)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
+	return client
+}
+
+// newFakeClient returns the in-process fake and a client logged in to it as TestUsername, for tests that need to
+// control the server and so cannot run against a real one
+func newFakeClient(t *testing.T, options ...ClientOption) (*proxmoxtest.Server, *Client) {
+	server := proxmoxtest.NewServer()
+	t.Cleanup(server.Close)
+
+	return server, newClientWith(t, server.URL, append([]ClientOption{WithLogger(testLogger), WithHTTPClient(server.Client())}, options...))
+}
+
+// newTestClient returns a client logged in to the test server as TestUsername
+func newTestClient(t *testing.T) *Client {
+	host, options := testHost(t)
+	return newClientWith(t, host, options)
+}
+
+func TestLogin(t *testing.T) {
+	client := newTestClient(t)
+
 	if client == nil {
 		t.Errorf("Client was not initialised")
 	}
@@ -29,8 +105,136 @@ func TestLogin(t *testing.T) {
 }
 
 func TestIncorrectUsername(t *testing.T) {
-	_, err := NewClient(DefaultHostURL, TestUsername, "wrong", slog.LevelDebug)
+	host, options := testHost(t)
+
+	_, err := NewClient(host, append(options, WithTicketAuth(TestUsername, "wrong"))...)
 	if err == nil {
 		t.Error("Expected authentication failure")
 	}
 }
+
+func TestAPITokenAuthentication(t *testing.T) {
+	const tokenID = "root@pam!ci"
+	const tokenSecret = "00000000-0000-0000-0000-000000000000"
+
+	server := proxmoxtest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddAPIToken(tokenID, tokenSecret)
+
+	server.OnRequest(func(request *http.Request, params map[string]any) {
+		if request.Header.Get("Authorization") != "PVEAPIToken="+tokenID+"="+tokenSecret {
+			t.Errorf("Expected API token header, got %q", request.Header.Get("Authorization"))
+		}
+		if _, err := request.Cookie("PVEAuthCookie"); err == nil {
+			t.Errorf("Expected no ticket cookie when using an API token")
+		}
+	})
+
+	client, err := NewClient(server.URL, WithAPIToken(tokenID, tokenSecret), WithLogger(testLogger), WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Ticket != nil {
+		t.Errorf("Expected no ticket when using an API token")
+	}
+
+	nodes, err := client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Node != "pve" {
+		t.Errorf("Expected node pve, got %v", nodes)
+	}
+
+	// Changes need no CSRF token with an API token
+	upid := startTestTask(t, client)
+
+	task, err := client.GetTask(context.Background(), upid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != "stopped" {
+		t.Errorf("Expected task to be stopped, got %q", task.Status)
+	}
+}
+
+func TestAPITokenRequired(t *testing.T) {
+	_, err := NewClient(DefaultHostURL, WithAPIToken("root@pam!ci", ""), WithLogger(testLogger), WithInsecureSkipVerify())
+	if err == nil {
+		t.Error("Expected an error when the token secret is missing")
+	}
+}
+
+// countLogins counts the logins the fake answers
+func countLogins(server *proxmoxtest.Server) *atomic.Int64 {
+	var logins atomic.Int64
+	server.OnRequest(func(request *http.Request, params map[string]any) {
+		if request.URL.Path == ApiPath+AuthenticationTicketPath {
+			logins.Add(1)
+		}
+	})
+	return &logins
+}
+
+func TestTicketRenewedOnUnauthorized(t *testing.T) {
+	server, client := newFakeClient(t)
+
+	ticket := client.Ticket.Data.Ticket
+
+	// The ticket held by the client is no longer accepted
+	server.ExpireTickets()
+
+	_, err := client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Ticket.Data.Ticket == ticket {
+		t.Errorf("Expected the client to renew its ticket, got %q", client.Ticket.Data.Ticket)
+	}
+}
+
+func TestTicketRenewedBeforeExpiry(t *testing.T) {
+	server, client := newFakeClient(t)
+	logins := countLogins(server)
+
+	client.TicketIssued = time.Now().Add(-TicketLifetime)
+
+	_, err := client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if logins.Load() != 1 {
+		t.Errorf("Expected the ticket to be renewed once, got %d logins", logins.Load())
+	}
+
+	if time.Since(client.TicketIssued) > time.Minute {
+		t.Errorf("Expected the ticket issue time to be updated, got %v", client.TicketIssued)
+	}
+}
+
+func TestTicketRenewedOnceWhenShared(t *testing.T) {
+	server, client := newFakeClient(t)
+	logins := countLogins(server)
+
+	client.TicketIssued = time.Now().Add(-TicketLifetime)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetNodes(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if logins.Load() != 1 {
+		t.Errorf("Expected the ticket to be renewed once, got %d logins", logins.Load())
+	}
+}
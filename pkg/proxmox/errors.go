@@ -0,0 +1,114 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrEFIDiskRequiresOVMF is returned when creating or updating a VM would leave it with an EFI disk but without the
+// ovmf bios
+var ErrEFIDiskRequiresOVMF = errors.New("an EFI disk requires the ovmf bios")
+
+// APIError is returned when the Proxmox API answers with a status other than 200 OK.
+// Use errors.As to get at it, or the IsNotFound, IsUnauthorized, IsPermissionDenied and IsLocked helpers.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Message is the reason Proxmox gives for the failure, taken from the body or the status line
+	Message string
+	// Errors holds the messages for individual parameters when parameter verification fails
+	Errors map[string]string
+	Body   []byte
+}
+
+// newAPIError builds an APIError from a response. Proxmox puts the reason in the status line, e.g.
+// "500 Configuration file 'nodes/pve/qemu-server/100.conf' does not exist", and newer versions also in the body.
+func newAPIError(method string, path string, response *http.Response, body []byte) *APIError {
+	apiError := &APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: response.StatusCode,
+		Message:    strings.TrimSpace(strings.TrimPrefix(response.Status, fmt.Sprintf("%d", response.StatusCode))),
+		Body:       body,
+	}
+
+	errorModel := struct {
+		Message string            `json:"message"`
+		Errors  map[string]string `json:"errors"`
+	}{}
+	if json.Unmarshal(body, &errorModel) == nil {
+		if errorModel.Message != "" {
+			apiError.Message = strings.TrimSpace(errorModel.Message)
+		}
+		apiError.Errors = errorModel.Errors
+	}
+
+	return apiError
+}
+
+func (apiError *APIError) Error() string {
+	message := fmt.Sprintf("%s %s: %d %s", apiError.Method, apiError.Path, apiError.StatusCode, apiError.Message)
+
+	if len(apiError.Errors) > 0 {
+		parameters := make([]string, 0, len(apiError.Errors))
+		for parameter := range apiError.Errors {
+			parameters = append(parameters, parameter)
+		}
+		sort.Strings(parameters)
+
+		details := make([]string, len(parameters))
+		for i, parameter := range parameters {
+			details[i] = parameter + ": " + strings.TrimSpace(apiError.Errors[parameter])
+		}
+		message += " (" + strings.Join(details, ", ") + ")"
+	}
+
+	return message
+}
+
+// IsNotFound reports whether the error is an APIError for a resource that does not exist.
+// Proxmox answers 500 rather than 404 for most missing resources, so the message is checked as well.
+func IsNotFound(err error) bool {
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	if apiError.StatusCode == http.StatusNotFound {
+		return true
+	}
+
+	message := strings.ToLower(apiError.Message)
+	return strings.Contains(message, "does not exist") || strings.Contains(message, "no such")
+}
+
+// IsUnauthorized reports whether the error is an APIError for a request without valid credentials
+func IsUnauthorized(err error) bool {
+	var apiError *APIError
+	return errors.As(err, &apiError) && apiError.StatusCode == http.StatusUnauthorized
+}
+
+// IsPermissionDenied reports whether the error is an APIError for a request the user is not allowed to make
+func IsPermissionDenied(err error) bool {
+	var apiError *APIError
+	return errors.As(err, &apiError) && apiError.StatusCode == http.StatusForbidden
+}
+
+// IsLocked reports whether the error is an APIError caused by a locked configuration,
+// for example while a backup or another task holds the lock of the VM.
+func IsLocked(err error) bool {
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	message := strings.ToLower(apiError.Message)
+	return strings.Contains(message, "is locked") ||
+		strings.Contains(message, "can't lock file") ||
+		strings.Contains(message, "got timeout")
+}
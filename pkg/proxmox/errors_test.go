@@ -0,0 +1,98 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/clincha-org/proxmox-api/pkg/ide"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAPIErrorNotFound(t *testing.T) {
+	_, client := newFakeClient(t)
+
+	_, err := client.GetVM(context.Background(), "pve", 999)
+
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		t.Fatalf("Expected an APIError, got %v", err)
+	}
+
+	if apiError.StatusCode != 500 || apiError.Method != "GET" || apiError.Path != "nodes/pve/qemu/999/config" {
+		t.Errorf("Unexpected APIError %+v", apiError)
+	}
+
+	if !IsNotFound(err) {
+		t.Errorf("Expected IsNotFound to be true for %v", err)
+	}
+
+	if IsLocked(err) || IsUnauthorized(err) || IsPermissionDenied(err) {
+		t.Errorf("Expected only IsNotFound to be true for %v", err)
+	}
+}
+
+func TestAPIErrorStatusLine(t *testing.T) {
+	// Older versions of Proxmox only put the reason in the status line
+	response := &http.Response{StatusCode: 500, Status: "500 Configuration file 'nodes/pve/qemu-server/999.conf' does not exist"}
+
+	apiError := newAPIError("GET", "nodes/pve/qemu/999/config", response, []byte(`{"data":null}`))
+
+	if apiError.Message != "Configuration file 'nodes/pve/qemu-server/999.conf' does not exist" {
+		t.Errorf("Expected the reason from the status line, got %q", apiError.Message)
+	}
+}
+
+func TestAPIErrorParameters(t *testing.T) {
+	_, client := newFakeClient(t)
+
+	cores := int64(1)
+	memory := int64(512)
+	_, err := client.CreateVM(context.Background(), "pve", &VirtualMachine{ID: 102, IDEDevices: &[]ide.InternalDataStorage{}, Cores: &cores, Memory: &memory}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooLittle := int64(1)
+	_, err = client.UpdateVM(context.Background(), "pve", &VirtualMachine{ID: 102, Memory: &tooLittle})
+
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		t.Fatalf("Expected an APIError, got %v", err)
+	}
+
+	if apiError.Errors["memory"] == "" {
+		t.Errorf("Expected a message for the memory parameter, got %v", apiError.Errors)
+	}
+
+	if !strings.Contains(err.Error(), "memory: value must have a minimum value of 16") {
+		t.Errorf("Expected the parameter message in the error, got %q", err.Error())
+	}
+}
+
+func TestAPIErrorHelpers(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		check    func(error) bool
+		expected bool
+	}{
+		{"unauthorized", &APIError{StatusCode: 401, Message: "authentication failure"}, IsUnauthorized, true},
+		{"permission denied", &APIError{StatusCode: 403, Message: "Permission check failed (/vms/100, VM.Allocate)"}, IsPermissionDenied, true},
+		{"locked", &APIError{StatusCode: 500, Message: "VM is locked (backup)"}, IsLocked, true},
+		{"lock timeout", &APIError{StatusCode: 500, Message: "can't lock file '/var/lock/qemu-server/lock-100.conf' - got timeout"}, IsLocked, true},
+		{"not found status", &APIError{StatusCode: 404}, IsNotFound, true},
+		{"wrapped", fmt.Errorf("GetVM-request: %w", &APIError{StatusCode: 401}), IsUnauthorized, true},
+		{"other error", errors.New("connection refused"), IsNotFound, false},
+		{"other status", &APIError{StatusCode: 500, Message: "internal error"}, IsLocked, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.check(test.err) != test.expected {
+				t.Errorf("Expected %v for %v", test.expected, test.err)
+			}
+		})
+	}
+}
@@ -1,18 +1,5 @@
 package proxmox
 
-// The response from the Proxmox server is wrapped in an JSON object called "data".
-// The Response structs deal with unwrapping these objects.
-
-// NetworksResponse The response from Proxmox when a list of networks is returned
-type NetworksResponse struct {
-	Data []Network `json:"data"`
-}
-
-// NetworkResponse The response from Proxmox when a single network is returned
-type NetworkResponse struct {
-	Data Network `json:"data"`
-}
-
 // The NetworkRequest struct handles the create and update requests we need to send to the Proxmox server.
 // This is different from the Network structure because the API endpoints don't accept the same fields they return.
 // https://github.com/clincha-org/proxmox-api/issues/5
@@ -1,25 +1,22 @@
 package proxmox
 
 import (
-	"log/slog"
+	"context"
 	"strings"
 	"testing"
 )
 
 func TestGetDefaultInterface(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
-	nodes, err := client.GetNodes()
+	nodes, err := client.GetNodes(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	node := &nodes[0]
 
-	network, err := client.GetNetwork(node, "vmbr0")
+	network, err := client.GetNetwork(context.Background(), node, "vmbr0")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -30,12 +27,9 @@ func TestGetDefaultInterface(t *testing.T) {
 }
 
 func TestNetworkNetmaskUpdate(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
-	nodes, err := client.GetNodes()
+	nodes, err := client.GetNodes(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -51,12 +45,12 @@ func TestNetworkNetmaskUpdate(t *testing.T) {
 		Netmask:   &TestNetmask,
 	}
 
-	network, err := client.CreateNetwork(node, &request)
+	network, err := client.CreateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
-		_ = client.DeleteNetwork(node, "vmbr22")
+		_ = client.DeleteNetwork(context.Background(), node, "vmbr22")
 	})
 
 	if *network.Netmask != TestNetmask {
@@ -71,7 +65,7 @@ func TestNetworkNetmaskUpdate(t *testing.T) {
 		Netmask:   &TestNetmask,
 	}
 
-	network, err = client.UpdateNetwork(node, &request)
+	network, err = client.UpdateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -82,12 +76,9 @@ func TestNetworkNetmaskUpdate(t *testing.T) {
 }
 
 func TestNetworkCIDRUpdate(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
-	nodes, err := client.GetNodes()
+	nodes, err := client.GetNodes(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -101,12 +92,12 @@ func TestNetworkCIDRUpdate(t *testing.T) {
 		CIDR:      &TestCIDR,
 	}
 
-	network, err := client.CreateNetwork(node, &request)
+	network, err := client.CreateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
-		_ = client.DeleteNetwork(node, "vmbr22")
+		_ = client.DeleteNetwork(context.Background(), node, "vmbr22")
 	})
 
 	if *network.Address != strings.Split(TestCIDR, "/")[0] {
@@ -126,7 +117,7 @@ func TestNetworkCIDRUpdate(t *testing.T) {
 		Netmask:   &TestNetmask,
 	}
 
-	network, err = client.UpdateNetwork(node, &request)
+	network, err = client.UpdateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -141,12 +132,9 @@ func TestNetworkCIDRUpdate(t *testing.T) {
 }
 
 func TestNetworkAutostart(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
-	nodes, err := client.GetNodes()
+	nodes, err := client.GetNodes(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -160,12 +148,12 @@ func TestNetworkAutostart(t *testing.T) {
 		AutoStart: &autostart,
 	}
 
-	network, err := client.CreateNetwork(node, &request)
+	network, err := client.CreateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
-		_ = client.DeleteNetwork(node, "vmbr22")
+		_ = client.DeleteNetwork(context.Background(), node, "vmbr22")
 	})
 
 	if network.Autostart != 1 {
@@ -179,7 +167,7 @@ func TestNetworkAutostart(t *testing.T) {
 		AutoStart: &autostart,
 	}
 
-	network, err = client.UpdateNetwork(node, &request)
+	network, err = client.UpdateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -190,12 +178,9 @@ func TestNetworkAutostart(t *testing.T) {
 }
 
 func TestNetworkBridgePorts(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
-	nodes, err := client.GetNodes()
+	nodes, err := client.GetNodes(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -207,12 +192,12 @@ func TestNetworkBridgePorts(t *testing.T) {
 		Type:      "eth",
 	}
 
-	network, err := client.CreateNetwork(node, &request)
+	network, err := client.CreateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
-		_ = client.DeleteNetwork(node, "enp0s4")
+		_ = client.DeleteNetwork(context.Background(), node, "enp0s4")
 	})
 
 	TestCIDR := "10.0.3.13/24"
@@ -224,12 +209,12 @@ func TestNetworkBridgePorts(t *testing.T) {
 		BridgePorts: &TestBridgePorts,
 	}
 
-	network, err = client.CreateNetwork(node, &request)
+	network, err = client.CreateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
-		_ = client.DeleteNetwork(node, "vmbr22")
+		_ = client.DeleteNetwork(context.Background(), node, "vmbr22")
 	})
 
 	if *network.BridgePorts != TestBridgePorts {
@@ -238,12 +223,9 @@ func TestNetworkBridgePorts(t *testing.T) {
 }
 
 func TestNetworkOmittedFields(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
-	nodes, err := client.GetNodes()
+	nodes, err := client.GetNodes(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -259,12 +241,12 @@ func TestNetworkOmittedFields(t *testing.T) {
 		Comments:  &TestComments,
 	}
 
-	network, err := client.CreateNetwork(node, &request)
+	network, err := client.CreateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
-		_ = client.DeleteNetwork(node, "vmbr22")
+		_ = client.DeleteNetwork(context.Background(), node, "vmbr22")
 	})
 	if network.Autostart != 1 {
 		t.Fatalf("Expected network autostart to be 1, got %v instead", network.Autostart)
@@ -278,7 +260,7 @@ func TestNetworkOmittedFields(t *testing.T) {
 		Type:      "bridge",
 	}
 
-	network, err = client.UpdateNetwork(node, &request)
+	network, err = client.UpdateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -298,7 +280,7 @@ func TestNetworkOmittedFields(t *testing.T) {
 		Comments:  &TestComments,
 	}
 
-	network, err = client.UpdateNetwork(node, &request)
+	network, err = client.UpdateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -311,12 +293,9 @@ func TestNetworkOmittedFields(t *testing.T) {
 }
 
 func TestSubnetMaskReturnedInSameFormat(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
-	nodes, err := client.GetNodes()
+	nodes, err := client.GetNodes(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -332,12 +311,12 @@ func TestSubnetMaskReturnedInSameFormat(t *testing.T) {
 		Netmask:   &TestNetmask,
 	}
 
-	network, err := client.CreateNetwork(node, &request)
+	network, err := client.CreateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
-		_ = client.DeleteNetwork(node, "vmbr22")
+		_ = client.DeleteNetwork(context.Background(), node, "vmbr22")
 	})
 
 	if *network.Netmask != TestNetmask {
@@ -346,12 +325,9 @@ func TestSubnetMaskReturnedInSameFormat(t *testing.T) {
 }
 
 func TestNetworkWithOnlyName(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
-	nodes, err := client.GetNodes()
+	nodes, err := client.GetNodes(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -363,12 +339,12 @@ func TestNetworkWithOnlyName(t *testing.T) {
 		Type:      "bridge",
 	}
 
-	network, err := client.CreateNetwork(node, &request)
+	network, err := client.CreateNetwork(context.Background(), node, &request)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
-		_ = client.DeleteNetwork(node, "vmbr22")
+		_ = client.DeleteNetwork(context.Background(), node, "vmbr22")
 	})
 
 	if network.Interface != "vmbr22" {
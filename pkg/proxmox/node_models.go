@@ -1,9 +1,5 @@
 package proxmox
 
-type NodeResponse struct {
-	Data []Node `json:"data"`
-}
-
 type Node struct {
 	Type           string  `json:"type"`
 	Maxcpu         int64   `json:"maxcpu"`
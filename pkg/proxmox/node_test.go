@@ -1,17 +1,14 @@
 package proxmox
 
 import (
-	"log/slog"
+	"context"
 	"testing"
 )
 
 func TestGetNodes(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Error(err)
-	}
+	client := newTestClient(t)
 
-	nodes, err := client.GetNodes()
+	nodes, err := client.GetNodes(context.Background())
 	if err != nil {
 		t.Error(err)
 	}
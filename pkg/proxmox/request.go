@@ -0,0 +1,107 @@
+package proxmox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// The response from the Proxmox server is wrapped in an JSON object called "data".
+// apiResponse deals with unwrapping this object for every endpoint.
+type apiResponse[T any] struct {
+	Data T `json:"data"`
+}
+
+// do sends a request to the Proxmox API and unmarshals the data field of the response into T.
+// The path is relative to ApiPath, the query is added to the URL when it is not empty and the body is sent as JSON
+// when it is not nil. Every endpoint goes through do so authentication, logging and retries only happen here.
+func do[T any](ctx context.Context, client *Client, method string, path string, query url.Values, body any) (T, error) {
+	var data T
+
+	requestURL := client.Host + ApiPath + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	var jsonData []byte
+	if body != nil {
+		var err error
+		jsonData, err = json.Marshal(body)
+		if err != nil {
+			return data, fmt.Errorf("do-marshal-request: %w", err)
+		}
+	}
+
+	var responseBody []byte
+	for attempt := 1; ; attempt++ {
+		var err error
+		responseBody, err = client.attempt(ctx, method, path, requestURL, jsonData)
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil || !client.RetryPolicy.shouldRetry(method, attempt, err) {
+			return data, err
+		}
+
+		delay := client.RetryPolicy.backoff(attempt)
+		client.Logger.Warn("api-retry", "method", method, "path", path, "attempt", attempt, "delay", delay, "error", err)
+
+		err = sleep(ctx, delay)
+		if err != nil {
+			return data, fmt.Errorf("do-retry-wait: %w", err)
+		}
+	}
+
+	wrapper := apiResponse[T]{}
+	err := json.Unmarshal(responseBody, &wrapper)
+	if err != nil {
+		return data, fmt.Errorf("do-unmarshal-response: %w", err)
+	}
+
+	return wrapper.Data, nil
+}
+
+// attempt sends the request once and returns the body of the response, or an APIError when the status is not 200 OK
+func (client *Client) attempt(ctx context.Context, method string, path string, requestURL string, jsonData []byte) ([]byte, error) {
+	var requestBody io.Reader
+	if jsonData != nil {
+		requestBody = bytes.NewReader(jsonData)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, requestURL, requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("do-build-request: %w", err)
+	}
+
+	if jsonData != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := client.send(request)
+	if err != nil {
+		return nil, fmt.Errorf("do-request: %w", err)
+	}
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("do-read-response: %w", err)
+	}
+
+	err = response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("do-close-response: %w", err)
+	}
+
+	client.Logger.Debug("api-response", "method", method, "path", path, "status", response.Status, "response", string(responseBody))
+
+	if response.StatusCode != http.StatusOK {
+		return nil, newAPIError(method, path, response, responseBody)
+	}
+
+	return responseBody, nil
+}
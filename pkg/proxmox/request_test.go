@@ -0,0 +1,58 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestDoRequest(t *testing.T) {
+	server, client := newFakeClient(t)
+
+	server.OnRequest(func(request *http.Request, params map[string]any) {
+		if request.URL.Path == ApiPath+AuthenticationTicketPath {
+			return
+		}
+
+		if request.Method != "POST" || request.URL.Path != ApiPath+"nodes/pve/qemu" {
+			t.Errorf("Expected POST to nodes/pve/qemu, got %s %s", request.Method, request.URL.Path)
+		}
+
+		if request.URL.Query().Get("start") != "1" {
+			t.Errorf("Expected the query to be sent, got %q", request.URL.RawQuery)
+		}
+
+		if request.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON body, got %q", request.Header.Get("Content-Type"))
+		}
+
+		if request.Header.Get("CSRFPreventionToken") != client.Ticket.Data.CSRFPreventionToken {
+			t.Errorf("Expected the CSRF token to be sent, got %q", request.Header.Get("CSRFPreventionToken"))
+		}
+
+		if params["vmid"] != json.Number("102") {
+			t.Errorf("Expected vmid 102 in the body, got %v", params["vmid"])
+		}
+	})
+
+	upid, err := do[string](context.Background(), client, "POST", "nodes/pve/qemu", url.Values{"start": {"1"}}, map[string]int64{"vmid": 102})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseUPID(upid); err != nil {
+		t.Errorf("Expected the data field to be unwrapped, got %q", upid)
+	}
+}
+
+func TestDoRequestStatusError(t *testing.T) {
+	server, client := newFakeClient(t, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	server.FailRequests(1, http.StatusInternalServerError, "internal error")
+
+	_, err := do[[]Node](context.Background(), client, "GET", NodesPath, nil, nil)
+	if err == nil {
+		t.Error("Expected an error for a 500 response")
+	}
+}
@@ -0,0 +1,92 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// RetryPolicy controls how requests that fail with a transient error are retried.
+// Proxmox answers 500 for lock timeouts and 503 while pveproxy is busy, both of which usually succeed on a second try.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one. Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, it is multiplied by Multiplier for every following retry
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomises each delay by up to this fraction of it, so clients sharing a server do not retry in step
+	Jitter float64
+	// RetryableStatusCodes are the response statuses that are retried. Errors for resources that do not exist and
+	// failed parameter verification are never retried, whatever their status.
+	RetryableStatusCodes []int
+	// RetryNonIdempotent also retries POST and DELETE requests. Only enable this if repeating a request that may have
+	// been applied is safe for the way you use the client.
+	RetryNonIdempotent bool
+	// Retryable replaces the status code check when set. It is only called for methods that may be retried.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy is used by clients created with NewClient unless WithRetryPolicy is given
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:          3,
+	InitialBackoff:       500 * time.Millisecond,
+	MaxBackoff:           5 * time.Second,
+	Multiplier:           2,
+	Jitter:               0.2,
+	RetryableStatusCodes: []int{500, 502, 503, 504},
+}
+
+// idempotentMethods are the HTTP methods that can be repeated without changing the result. DELETE is left out: deleting
+// a VM or snapshot starts a task, and repeating a delete that was applied fails because the resource is already gone.
+var idempotentMethods = []string{"GET", "HEAD", "OPTIONS", "PUT"}
+
+// shouldRetry reports whether the request that failed with err on the given attempt should be sent again
+func (policy RetryPolicy) shouldRetry(method string, attempt int, err error) bool {
+	if attempt >= policy.MaxAttempts {
+		return false
+	}
+
+	if !policy.RetryNonIdempotent && !slices.Contains(idempotentMethods, method) {
+		return false
+	}
+
+	if policy.Retryable != nil {
+		return policy.Retryable(err)
+	}
+
+	var apiError *APIError
+	if errors.As(err, &apiError) {
+		if IsNotFound(apiError) || len(apiError.Errors) > 0 {
+			return false
+		}
+		return slices.Contains(policy.RetryableStatusCodes, apiError.StatusCode)
+	}
+
+	// Connection failures are retried, unless the caller cancelled the request
+	var urlError *url.Error
+	return errors.As(err, &urlError) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// backoff returns the delay before the retry that follows the given attempt
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(policy.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if policy.MaxBackoff > 0 && delay > float64(policy.MaxBackoff) {
+		delay = float64(policy.MaxBackoff)
+	}
+
+	if policy.Jitter > 0 {
+		delay += delay * policy.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
@@ -0,0 +1,122 @@
+package proxmox
+
+import (
+	"context"
+	"github.com/clincha-org/proxmox-api/pkg/ide"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:          3,
+	InitialBackoff:       time.Millisecond,
+	MaxBackoff:           10 * time.Millisecond,
+	Multiplier:           2,
+	Jitter:               0.2,
+	RetryableStatusCodes: []int{500, 502, 503, 504},
+}
+
+func TestRetryTransientFailure(t *testing.T) {
+	server, client := newFakeClient(t, WithRetryPolicy(testRetryPolicy))
+	server.FailRequests(2, http.StatusServiceUnavailable, "service unavailable")
+
+	_, err := client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Requests() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", server.Requests())
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	server, client := newFakeClient(t, WithRetryPolicy(testRetryPolicy))
+	server.FailRequests(10, http.StatusInternalServerError, "can't lock file '/var/lock/qemu-server/lock-102.conf' - got timeout")
+
+	_, err := client.GetNodes(context.Background())
+	if !IsLocked(err) {
+		t.Fatalf("Expected the lock error to be returned, got %v", err)
+	}
+
+	if server.Requests() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", server.Requests())
+	}
+}
+
+func TestRetryOnlyIdempotentMethods(t *testing.T) {
+	server, client := newFakeClient(t, WithRetryPolicy(testRetryPolicy))
+
+	cores := int64(1)
+	memory := int64(512)
+	_, err := client.CreateVM(context.Background(), "pve", &VirtualMachine{ID: 102, IDEDevices: &[]ide.InternalDataStorage{}, Cores: &cores, Memory: &memory}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := server.Requests()
+	server.FailRequests(1, http.StatusServiceUnavailable, "service unavailable")
+
+	_, err = client.StartVM(context.Background(), "pve", 102, PowerOptions{})
+	if err == nil {
+		t.Fatal("Expected the POST request not to be retried")
+	}
+
+	if attempts := server.Requests() - requests; attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+
+	requests = server.Requests()
+	server.FailRequests(1, http.StatusServiceUnavailable, "service unavailable")
+
+	_, err = do[UPID](context.Background(), client, "DELETE", NodesPath+"/pve"+VirtualMachinePath+"/102", nil, nil)
+	if err == nil {
+		t.Fatal("Expected the DELETE request not to be retried")
+	}
+
+	if attempts := server.Requests() - requests; attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+
+	policy := testRetryPolicy
+	policy.RetryNonIdempotent = true
+	client.RetryPolicy = policy
+
+	server.FailRequests(1, http.StatusServiceUnavailable, "service unavailable")
+
+	_, err = client.StartVM(context.Background(), "pve", 102, PowerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetrySkipsNotFound(t *testing.T) {
+	server, client := newFakeClient(t, WithRetryPolicy(testRetryPolicy))
+
+	_, err := client.GetVMStatus(context.Background(), "pve", 102)
+	if !IsNotFound(err) {
+		t.Fatalf("Expected a not found error, got %v", err)
+	}
+
+	if server.Requests() != 1 {
+		t.Errorf("Expected 1 attempt, got %d", server.Requests())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		if delay := policy.backoff(attempt); delay != expected {
+			t.Errorf("Expected a delay of %v after attempt %d, got %v", expected, attempt, delay)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := policy.backoff(1); delay < 500*time.Millisecond || delay > 1500*time.Millisecond {
+			t.Fatalf("Expected the delay to stay within the jitter, got %v", delay)
+		}
+	}
+}
@@ -1,55 +1,301 @@
 package proxmox
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log/slog"
-	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const taskPath = "/tasks"
 
-func (client *Client) GetTask(node string, id string) (Task, error) {
-	request, err := http.NewRequest(
-		"GET",
-		client.Host+ApiPath+NodesPath+"/"+node+taskPath+"/"+id+"/status",
-		nil,
-	)
+// TaskExitStatusOK is the exit status of a task that finished successfully
+const TaskExitStatusOK = "OK"
+
+// taskExitStatusWarnings starts the exit status of a task that finished successfully but logged warnings
+const taskExitStatusWarnings = "WARNINGS"
+
+// TaskWaitOptions controls how WaitForTask polls the status of a task. Zero values use the defaults.
+type TaskWaitOptions struct {
+	// PollInterval is the delay before the second poll, it grows by half with every poll up to MaxPollInterval
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	// Timeout limits how long to wait in addition to any deadline on the context
+	Timeout time.Duration
+	// StopOnCancel stops the task on the server when the context is done or the timeout passes before it finishes
+	StopOnCancel bool
+}
+
+// stopTaskTimeout limits how long WaitForTask spends stopping a task after its context is done
+const stopTaskTimeout = 10 * time.Second
+
+// taskLogPageSize is how many lines FollowTaskLog asks for at a time
+const taskLogPageSize = 500
+
+// DefaultTaskWaitOptions are used for the zero fields of the TaskWaitOptions passed to WaitForTask
+var DefaultTaskWaitOptions = TaskWaitOptions{
+	PollInterval:    500 * time.Millisecond,
+	MaxPollInterval: 5 * time.Second,
+}
+
+// TaskError is returned when a task stops with an error
+type TaskError struct {
+	UPID       UPID
+	ExitStatus string
+}
+
+func (taskError *TaskError) Error() string {
+	return fmt.Sprintf("task %s failed: %s", taskError.UPID, taskError.ExitStatus)
+}
+
+// ListTasks returns the task history of the node, most recent first.
+func (client *Client) ListTasks(ctx context.Context, node string, filter TaskFilter) ([]Task, error) {
+	query := url.Values{}
+	if filter.VMID != nil {
+		query.Set("vmid", strconv.FormatInt(*filter.VMID, 10))
+	}
+	if filter.Type != "" {
+		query.Set("typefilter", filter.Type)
+	}
+	if filter.User != "" {
+		query.Set("userfilter", filter.User)
+	}
+	if filter.Source != "" {
+		query.Set("source", filter.Source)
+	}
+	if filter.ErrorsOnly {
+		query.Set("errors", "1")
+	}
+	if len(filter.Statuses) > 0 {
+		query.Set("statusfilter", strings.Join(filter.Statuses, ","))
+	}
+	if !filter.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(filter.Since.Unix(), 10))
+	}
+	if !filter.Until.IsZero() {
+		query.Set("until", strconv.FormatInt(filter.Until.Unix(), 10))
+	}
+	if filter.Start > 0 {
+		query.Set("start", strconv.FormatInt(filter.Start, 10))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.FormatInt(filter.Limit, 10))
+	}
+
+	tasks, err := do[[]Task](ctx, client, "GET", NodesPath+"/"+node+taskPath, query, nil)
 	if err != nil {
-		return Task{}, fmt.Errorf("GetTask-build-request: %w", err)
+		return nil, fmt.Errorf("ListTasks-request: %w", err)
 	}
 
-	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
-	request.Header.Set("CSRFPreventionToken", client.Ticket.Data.CSRFPreventionToken)
+	// The list puts the exit status in the status field, so move it to match the status of a single task
+	for i := range tasks {
+		if tasks[i].EndTime != 0 {
+			tasks[i].ExitStatus = tasks[i].Status
+			tasks[i].Status = "stopped"
+		} else {
+			tasks[i].Status = "running"
+		}
+	}
+
+	return tasks, nil
+}
 
-	response, err := client.HTTPClient.Do(request)
+// GetTask returns the status of the task. When the task has stopped with an error the task is returned together with
+// a TaskError. Tasks that stopped with warnings succeeded.
+func (client *Client) GetTask(ctx context.Context, upid UPID) (Task, error) {
+	task, err := do[Task](ctx, client, "GET", upid.path()+"/status", nil, nil)
 	if err != nil {
-		return Task{}, fmt.Errorf("GetTask-do-request: %w", err)
+		return Task{}, fmt.Errorf("GetTask-request: %w", err)
 	}
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return Task{}, fmt.Errorf("GetTask-read-response: %w", err)
+	if task.Failed() {
+		return task, &TaskError{UPID: upid, ExitStatus: task.ExitStatus}
 	}
 
-	err = response.Body.Close()
+	return task, nil
+}
+
+// WaitForTask polls the task until it stops and returns its final status.
+// It returns a TaskError when the task failed, and the context error when the context is done or the timeout passes
+// first. With StopOnCancel set the task is also stopped on the server in that case.
+func (client *Client) WaitForTask(ctx context.Context, upid UPID, options TaskWaitOptions) (Task, error) {
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultTaskWaitOptions.PollInterval
+	}
+	if options.MaxPollInterval <= 0 {
+		options.MaxPollInterval = DefaultTaskWaitOptions.MaxPollInterval
+	}
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	task, err := client.pollTask(ctx, upid, options)
+
+	if err != nil && options.StopOnCancel && ctx.Err() != nil {
+		// The context is already done, so stopping the task needs one of its own
+		stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stopTaskTimeout)
+		defer cancel()
+
+		stopErr := client.StopTask(stopCtx, upid)
+		if stopErr != nil {
+			return task, errors.Join(err, fmt.Errorf("WaitForTask-stop-task: %w", stopErr))
+		}
+	}
+
+	return task, err
+}
+
+// pollTask polls the task until it stops or the context is done
+func (client *Client) pollTask(ctx context.Context, upid UPID, options TaskWaitOptions) (Task, error) {
+	interval := options.PollInterval
+	for {
+		task, err := client.GetTask(ctx, upid)
+
+		var taskError *TaskError
+		if errors.As(err, &taskError) {
+			return task, taskError
+		}
+
+		if err != nil {
+			return task, fmt.Errorf("WaitForTask-get-task: %w", err)
+		}
+
+		if !task.Running() {
+			return task, nil
+		}
+
+		err = sleep(ctx, interval)
+		if err != nil {
+			return task, fmt.Errorf("WaitForTask-wait: %w", err)
+		}
+
+		interval += interval / 2
+		if interval > options.MaxPollInterval {
+			interval = options.MaxPollInterval
+		}
+	}
+}
+
+// StopTask stops a running task, for example a backup or clone that hangs
+func (client *Client) StopTask(ctx context.Context, upid UPID) error {
+	_, err := do[any](ctx, client, "DELETE", upid.path(), nil, nil)
 	if err != nil {
-		return Task{}, fmt.Errorf("GetTask-close-response: %w", err)
+		return fmt.Errorf("StopTask-request: %w", err)
 	}
 
-	slog.Debug("api-response", "method", "GetTask", "status", response.Status, "response", string(body))
+	return nil
+}
 
-	if response.StatusCode != http.StatusOK {
-		return Task{}, fmt.Errorf("GetTask-status-error: %s %s", response.Status, body)
+// GetTaskLog returns the lines of the log of the task, starting after the first start lines.
+// A limit of 0 uses the default of the Proxmox API, which is 50 lines.
+func (client *Client) GetTaskLog(ctx context.Context, upid UPID, start int64, limit int64) ([]TaskLogLine, error) {
+	query := url.Values{}
+	query.Set("start", strconv.FormatInt(start, 10))
+	if limit > 0 {
+		query.Set("limit", strconv.FormatInt(limit, 10))
 	}
 
-	taskModel := TaskResponse{}
-	err = json.Unmarshal(body, &taskModel)
+	lines, err := do[[]TaskLogLine](ctx, client, "GET", upid.path()+"/log", query, nil)
 	if err != nil {
-		return Task{}, fmt.Errorf("GetTask-unmarshal-response: %w", err)
+		return nil, fmt.Errorf("GetTaskLog-request: %w", err)
 	}
 
-	return taskModel.Data, nil
+	return lines, nil
+}
+
+// FollowTaskLog streams the log of the task, one line of text per log line, until the task stops.
+// The log is polled with the intervals of the options. Reading returns io.EOF once a successful task has stopped and
+// all of its log has been read, or the TaskError of a failed task. Close the reader to stop following early.
+func (client *Client) FollowTaskLog(ctx context.Context, upid UPID, options TaskWaitOptions) io.ReadCloser {
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultTaskWaitOptions.PollInterval
+	}
+	if options.MaxPollInterval <= 0 {
+		options.MaxPollInterval = DefaultTaskWaitOptions.MaxPollInterval
+	}
+
+	var cancel context.CancelFunc
+	if options.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	reader, writer := io.Pipe()
+
+	go func() {
+		defer cancel()
+		writer.CloseWithError(client.followTaskLog(ctx, upid, options, writer))
+	}()
+
+	return &taskLogReader{PipeReader: reader, cancel: cancel}
+}
+
+// followTaskLog writes the log of the task to the writer until the task stops and returns the error to close it with
+func (client *Client) followTaskLog(ctx context.Context, upid UPID, options TaskWaitOptions, writer io.Writer) error {
+	var start int64
+	interval := options.PollInterval
+	for {
+		// Check the status before reading the log so no lines written before the task stopped are missed
+		task, taskErr := client.GetTask(ctx, upid)
+
+		var taskError *TaskError
+		if taskErr != nil && !errors.As(taskErr, &taskError) {
+			return fmt.Errorf("FollowTaskLog-get-task: %w", taskErr)
+		}
+
+		lines, err := client.GetTaskLog(ctx, upid, start, taskLogPageSize)
+		if err != nil {
+			return fmt.Errorf("FollowTaskLog-get-task-log: %w", err)
+		}
+
+		// Proxmox answers with a single "no content" line while the log of a task is still empty
+		if start == 0 && len(lines) == 1 && lines[0].Text == "no content" && task.Running() {
+			lines = nil
+		}
+
+		for _, line := range lines {
+			_, err = io.WriteString(writer, line.Text+"\n")
+			if err != nil {
+				return err
+			}
+			start = line.LineNumber
+		}
+
+		// There may be more lines waiting
+		if len(lines) == taskLogPageSize {
+			continue
+		}
+
+		if !task.Running() {
+			return taskErr
+		}
+
+		err = sleep(ctx, interval)
+		if err != nil {
+			return fmt.Errorf("FollowTaskLog-wait: %w", err)
+		}
+
+		interval += interval / 2
+		if interval > options.MaxPollInterval {
+			interval = options.MaxPollInterval
+		}
+	}
+}
+
+// taskLogReader stops following the log when it is closed
+type taskLogReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
 
+func (reader *taskLogReader) Close() error {
+	reader.cancel()
+	return reader.PipeReader.Close()
 }
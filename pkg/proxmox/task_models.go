@@ -1,20 +1,83 @@
 package proxmox
 
-type TaskResponse struct {
-	Data Task `json:"data"`
-}
+import (
+	"strings"
+	"time"
+)
 
 type Task struct {
 	ID        string `json:"id"`
 	Node      string `json:"node"`
 	PID       int64  `json:"pid"`
+	PStart    int64  `json:"pstart"`
 	StartTime int64  `json:"starttime"`
-	Status    string `json:"status"`
-	Type      string `json:"type"`
-	UPID      string `json:"upid"`
-	User      string `json:"user"`
+	// EndTime is only set once the task has stopped
+	EndTime int64  `json:"endtime"`
+	Status  string `json:"status"`
+	// ExitStatus is only set once the task has stopped, it is "OK" for tasks that succeeded
+	ExitStatus string `json:"exitstatus"`
+	Type       string `json:"type"`
+	UPID       UPID   `json:"upid"`
+	User       string `json:"user"`
+}
+
+// Running reports whether the task has not stopped yet
+func (task Task) Running() bool {
+	return task.Status == "running"
+}
+
+// Succeeded reports whether the task has stopped with exit status OK, or with warnings
+func (task Task) Succeeded() bool {
+	return task.Status == "stopped" && (task.ExitStatus == TaskExitStatusOK || task.Warnings())
+}
+
+// Warnings reports whether the task has stopped successfully but logged warnings, Proxmox then sets the exit status
+// to "WARNINGS: " and the number of warnings
+func (task Task) Warnings() bool {
+	return task.Status == "stopped" && strings.HasPrefix(task.ExitStatus, taskExitStatusWarnings)
+}
+
+// Failed reports whether the task has stopped with an error
+func (task Task) Failed() bool {
+	return task.Status == "stopped" && !task.Succeeded()
+}
+
+// Duration returns how long the task ran for, or how long it has been running so far if it has not stopped
+func (task Task) Duration() time.Duration {
+	if task.StartTime == 0 {
+		return 0
+	}
+
+	end := time.Now()
+	if task.EndTime != 0 {
+		end = time.Unix(task.EndTime, 0)
+	}
+
+	return end.Sub(time.Unix(task.StartTime, 0))
+}
+
+// TaskLogLine is a line of the log of a task. Line numbers start at 1.
+type TaskLogLine struct {
+	LineNumber int64  `json:"n"`
+	Text       string `json:"t"`
 }
 
-type JobResponse struct {
-	ID string `json:"data"`
+// TaskFilter narrows down the tasks returned by ListTasks. Zero values are not sent to the API.
+type TaskFilter struct {
+	VMID *int64
+	// Type only returns tasks of this type, for example qmcreate
+	Type string
+	// User only returns tasks started by this user, for example root@pam
+	User string
+	// Source is "archive" for finished tasks, which is the default, "active" for running tasks or "all"
+	Source string
+	// ErrorsOnly only returns tasks that failed
+	ErrorsOnly bool
+	// Statuses only returns tasks with these statuses: ok, error, warning or unknown
+	Statuses []string
+	Since    time.Time
+	Until    time.Time
+	// Start skips this many tasks, Limit caps the number returned. The API returns 50 tasks when Limit is 0.
+	Start int64
+	Limit int64
 }
@@ -0,0 +1,405 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"github.com/clincha-org/proxmox-api/pkg/ide"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testUPID = "UPID:pve:00001234:00005678:65A1B2C3:qmcreate:102:root@pam:"
+
+var testTaskUPID = UPID{Node: "pve", PID: 0x1234, PStart: 0x5678, StartTime: 0x65A1B2C3, Type: "qmcreate", ID: "102", User: "root@pam"}
+
+var testTaskWaitOptions = TaskWaitOptions{PollInterval: time.Millisecond, MaxPollInterval: 5 * time.Millisecond}
+
+// startTestTask creates VM 102 on the fake and starts it without waiting, so the qmstart task runs the way the fake
+// was told to
+func startTestTask(t *testing.T, client *Client) UPID {
+	cores := int64(1)
+	memory := int64(512)
+	_, err := client.CreateVM(context.Background(), "pve", &VirtualMachine{ID: 102, IDEDevices: &[]ide.InternalDataStorage{}, Cores: &cores, Memory: &memory}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upid, err := client.StartVM(context.Background(), "pve", 102, PowerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return upid
+}
+
+func TestWaitForTask(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.RunTasks("qmstart", "starting VM 102", "VM 102 started", "waiting for the guest agent")
+
+	upid := startTestTask(t, client)
+	requests := server.Requests()
+
+	task, err := client.WaitForTask(context.Background(), upid, testTaskWaitOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Status != "stopped" || task.ExitStatus != TaskExitStatusOK {
+		t.Errorf("Expected the task to have stopped successfully, got %+v", task)
+	}
+
+	if polls := server.Requests() - requests; polls != 4 {
+		t.Errorf("Expected 4 polls, got %d", polls)
+	}
+}
+
+func TestWaitForTaskFailed(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.RunTasks("qmstart", "starting VM 102")
+	server.FailTasks("qmstart", "start failed: QEMU exited with code 1")
+
+	upid := startTestTask(t, client)
+
+	_, err := client.WaitForTask(context.Background(), upid, testTaskWaitOptions)
+
+	var taskError *TaskError
+	if !errors.As(err, &taskError) {
+		t.Fatalf("Expected a TaskError, got %v", err)
+	}
+
+	if taskError.ExitStatus != "start failed: QEMU exited with code 1" {
+		t.Errorf("Expected the exit status of the task, got %q", taskError.ExitStatus)
+	}
+
+	if taskError.UPID != upid {
+		t.Errorf("Unexpected TaskError %+v", taskError)
+	}
+
+	if taskError.Error() != "task "+upid.String()+" failed: "+taskError.ExitStatus {
+		t.Errorf("Expected the UPID and exit status in the message, got %q", taskError.Error())
+	}
+}
+
+func TestWaitForTaskWarnings(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.FailTasks("qmstart", "WARNINGS: 1")
+
+	upid := startTestTask(t, client)
+
+	task, err := client.WaitForTask(context.Background(), upid, testTaskWaitOptions)
+	if err != nil {
+		t.Fatalf("Expected a task with warnings to succeed, got %v", err)
+	}
+
+	if !task.Warnings() {
+		t.Errorf("Expected the task to report its warnings, got %+v", task)
+	}
+}
+
+func TestWaitForTaskTimeout(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.HangTasks("qmstart")
+
+	upid := startTestTask(t, client)
+
+	options := testTaskWaitOptions
+	options.Timeout = 50 * time.Millisecond
+
+	_, err := client.WaitForTask(context.Background(), upid, options)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the timeout to stop waiting, got %v", err)
+	}
+}
+
+func TestGetTaskFailed(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.FailTasks("qmstart", "command 'qm start 102' failed: exit code 1")
+
+	upid := startTestTask(t, client)
+
+	task, err := client.GetTask(context.Background(), upid)
+
+	var taskError *TaskError
+	if !errors.As(err, &taskError) {
+		t.Fatalf("Expected a TaskError, got %v", err)
+	}
+
+	if !task.Failed() || task.Succeeded() || task.Running() {
+		t.Errorf("Expected the task to be returned as failed, got %+v", task)
+	}
+}
+
+func TestTaskHelpers(t *testing.T) {
+	running := Task{Status: "running", StartTime: time.Now().Add(-time.Minute).Unix()}
+	if !running.Running() || running.Succeeded() || running.Failed() {
+		t.Errorf("Expected the task to be running, got %+v", running)
+	}
+	if running.Duration() < time.Minute {
+		t.Errorf("Expected a running task to have run for at least a minute, got %v", running.Duration())
+	}
+
+	succeeded := Task{Status: "stopped", ExitStatus: TaskExitStatusOK, StartTime: 1700000000, EndTime: 1700000042}
+	if succeeded.Running() || !succeeded.Succeeded() || succeeded.Failed() {
+		t.Errorf("Expected the task to have succeeded, got %+v", succeeded)
+	}
+	if succeeded.Duration() != 42*time.Second {
+		t.Errorf("Expected the task to have run for 42 seconds, got %v", succeeded.Duration())
+	}
+
+	warnings := Task{Status: "stopped", ExitStatus: "WARNINGS: 2"}
+	if warnings.Running() || !warnings.Succeeded() || !warnings.Warnings() || warnings.Failed() {
+		t.Errorf("Expected the task to have succeeded with warnings, got %+v", warnings)
+	}
+
+	failed := Task{Status: "stopped", ExitStatus: "interrupted by signal"}
+	if failed.Running() || failed.Succeeded() || !failed.Failed() {
+		t.Errorf("Expected the task to have failed, got %+v", failed)
+	}
+}
+
+func TestGetTaskLog(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.RunTasks("qmstart", "starting task", "formatting disk")
+
+	upid := startTestTask(t, client)
+
+	_, err := client.WaitForTask(context.Background(), upid, testTaskWaitOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := client.GetTaskLog(context.Background(), upid, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log) != 1 || log[0].LineNumber != 2 || log[0].Text != "formatting disk" {
+		t.Errorf("Expected the second line of the log, got %+v", log)
+	}
+}
+
+func TestFollowTaskLog(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.RunTasks("qmstart", "starting task", "formatting disk")
+
+	upid := startTestTask(t, client)
+
+	reader := client.FollowTaskLog(context.Background(), upid, testTaskWaitOptions)
+	defer reader.Close()
+
+	log, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(log) != "starting task\nformatting disk\nTASK OK\n" {
+		t.Errorf("Expected the whole log, got %q", log)
+	}
+}
+
+func TestFollowTaskLogFailed(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.RunTasks("qmstart", "starting task")
+	server.FailTasks("qmstart", "interrupted by signal")
+
+	upid := startTestTask(t, client)
+
+	reader := client.FollowTaskLog(context.Background(), upid, testTaskWaitOptions)
+	defer reader.Close()
+
+	log, err := io.ReadAll(reader)
+
+	var taskError *TaskError
+	if !errors.As(err, &taskError) {
+		t.Fatalf("Expected a TaskError, got %v", err)
+	}
+
+	if string(log) != "starting task\nTASK ERROR: interrupted by signal\n" {
+		t.Errorf("Expected the whole log before the error, got %q", log)
+	}
+}
+
+func TestListTasks(t *testing.T) {
+	server, client := newFakeClient(t)
+
+	var query url.Values
+	server.OnRequest(func(request *http.Request, params map[string]any) {
+		if request.URL.Path == ApiPath+NodesPath+"/pve"+taskPath {
+			query = request.URL.Query()
+		}
+	})
+
+	startTestTask(t, client)
+
+	server.HangTasks("qmreboot")
+	_, err := client.RebootVM(context.Background(), "pve", 102, RebootOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.FailTasks("qmstop", "unable to stop VM 102")
+	_, err = client.StopVM(context.Background(), "pve", 102, PowerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vmid := int64(102)
+	since := time.Now().Add(-time.Hour)
+	until := time.Now().Add(time.Hour)
+	tasks, err := client.ListTasks(context.Background(), "pve", TaskFilter{
+		VMID:     &vmid,
+		User:     "root@pam",
+		Source:   "all",
+		Statuses: []string{"error", "unknown"},
+		Since:    since,
+		Until:    until,
+		Limit:    5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := url.Values{
+		"vmid":         {"102"},
+		"userfilter":   {"root@pam"},
+		"source":       {"all"},
+		"statusfilter": {"error,unknown"},
+		"since":        {strconv.FormatInt(since.Unix(), 10)},
+		"until":        {strconv.FormatInt(until.Unix(), 10)},
+		"limit":        {"5"},
+	}
+	if query.Encode() != expected.Encode() {
+		t.Errorf("Expected query %q, got %q", expected.Encode(), query.Encode())
+	}
+
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", len(tasks))
+	}
+
+	if !tasks[0].Failed() || tasks[0].ExitStatus != "unable to stop VM 102" || tasks[0].UPID.Type != "qmstop" {
+		t.Errorf("Expected the first task to be the failed stop, got %+v", tasks[0])
+	}
+
+	if !tasks[1].Running() || tasks[1].UPID.Type != "qmreboot" {
+		t.Errorf("Expected the second task to be the running reboot, got %+v", tasks[1])
+	}
+
+	tasks, err = client.ListTasks(context.Background(), "pve", TaskFilter{Type: "qmstop", ErrorsOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].UPID.Type != "qmstop" {
+		t.Errorf("Expected only the failed stop, got %+v", tasks)
+	}
+}
+
+func TestStopTask(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.HangTasks("qmstart")
+
+	upid := startTestTask(t, client)
+
+	err := client.StopTask(context.Background(), upid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WaitForTask(context.Background(), upid, testTaskWaitOptions)
+
+	var taskError *TaskError
+	if !errors.As(err, &taskError) {
+		t.Fatalf("Expected the stopped task to have failed, got %v", err)
+	}
+
+	if taskError.ExitStatus != "interrupted by signal" {
+		t.Errorf("Expected the task to have been interrupted, got %q", taskError.ExitStatus)
+	}
+}
+
+func TestWaitForTaskStopOnCancel(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.HangTasks("qmstart")
+
+	upid := startTestTask(t, client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.WaitForTask(ctx, upid, testTaskWaitOptions)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to stop waiting, got %v", err)
+	}
+
+	task, err := client.GetTask(context.Background(), upid)
+	if err != nil || !task.Running() {
+		t.Fatalf("Expected the task to keep running without StopOnCancel, got %+v and %v", task, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	options := testTaskWaitOptions
+	options.StopOnCancel = true
+
+	_, err = client.WaitForTask(ctx, upid, options)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to stop waiting, got %v", err)
+	}
+
+	task, _ = client.GetTask(context.Background(), upid)
+	if task.Running() {
+		t.Error("Expected the task to be stopped on the server")
+	}
+}
+
+// expiringContext reports that its deadline has passed once expire is called, without cancelling requests in flight
+type expiringContext struct {
+	context.Context
+	expired atomic.Bool
+}
+
+func (ctx *expiringContext) Err() error {
+	if ctx.expired.Load() {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestWaitForTaskStopOnCancelAfterFinish(t *testing.T) {
+	server, client := newFakeClient(t)
+	upid := startTestTask(t, client)
+
+	// The deadline passes while the status of the finished task is on its way back
+	ctx := &expiringContext{Context: context.Background()}
+	var stops atomic.Int64
+	server.OnRequest(func(request *http.Request, params map[string]any) {
+		switch {
+		case strings.HasSuffix(request.URL.Path, "/status"):
+			ctx.expired.Store(true)
+		case request.Method == "DELETE":
+			stops.Add(1)
+		}
+	})
+
+	options := testTaskWaitOptions
+	options.StopOnCancel = true
+
+	task, err := client.WaitForTask(ctx, upid, options)
+	if err != nil {
+		t.Fatalf("Expected the finished task to be returned without an error, got %v", err)
+	}
+
+	if !task.Succeeded() {
+		t.Errorf("Expected the task to have succeeded, got %+v", task)
+	}
+
+	if stops.Load() != 0 {
+		t.Error("Expected the finished task not to be stopped")
+	}
+}
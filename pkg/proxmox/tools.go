@@ -1,8 +1,10 @@
 package proxmox
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"time"
 )
 
 func ConvertCIDRToNetmask(cidr *string) (*string, error) {
@@ -14,3 +16,22 @@ func ConvertCIDRToNetmask(cidr *string) (*string, error) {
 	var netmask = fmt.Sprintf("%d.%d.%d.%d", byte(mask>>24), byte(mask>>16), byte(mask>>8), byte(mask))
 	return &netmask, nil
 }
+
+// sleep pauses for the duration or until the context is done, whichever happens first
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// seconds rounds the duration up to whole seconds, the unit of the timeouts of the API, so short timeouts are not sent
+// as 0
+func seconds(duration time.Duration) int64 {
+	return int64((duration + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,108 @@
+package proxmox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UPID is the unique process ID Proxmox gives every task, in the form UPID:node:pid:pstart:starttime:type:id:user:
+// The pid, pstart and starttime fields are uppercase hexadecimal of at least 8 digits. The node is part of the UPID, so
+// the task APIs only need the UPID to find a task.
+type UPID struct {
+	Node      string
+	PID       int64
+	PStart    int64
+	StartTime int64
+	// Type is the type of task, for example qmcreate or qmstart
+	Type string
+	// ID is the object the task works on, the VMID for VM tasks. It is empty for tasks without an object.
+	ID   string
+	User string
+}
+
+// ParseUPID parses a UPID string as returned by the Proxmox API. Numbers that are not written the way Proxmox writes
+// them are rejected, so String returns the UPID unchanged and the task APIs can find the task.
+func ParseUPID(upid string) (UPID, error) {
+	parts := strings.Split(upid, ":")
+	if len(parts) != 9 || parts[0] != "UPID" || parts[8] != "" {
+		return UPID{}, fmt.Errorf("invalid UPID %q", upid)
+	}
+
+	parsed := UPID{
+		Node: parts[1],
+		Type: parts[5],
+		ID:   parts[6],
+		User: parts[7],
+	}
+
+	var err error
+	for i, field := range []*int64{&parsed.PID, &parsed.PStart, &parsed.StartTime} {
+		*field, err = strconv.ParseInt(parts[2+i], 16, 64)
+		if err != nil {
+			return UPID{}, fmt.Errorf("invalid UPID %q: %w", upid, err)
+		}
+		if fmt.Sprintf("%08X", *field) != parts[2+i] {
+			return UPID{}, fmt.Errorf("invalid UPID %q: %q is not canonical hexadecimal", upid, parts[2+i])
+		}
+	}
+
+	if parsed.Node == "" {
+		return UPID{}, fmt.Errorf("invalid UPID %q: node is empty", upid)
+	}
+
+	return parsed, nil
+}
+
+// String formats the UPID the same way Proxmox does
+func (upid UPID) String() string {
+	return fmt.Sprintf("UPID:%s:%08X:%08X:%08X:%s:%s:%s:", upid.Node, upid.PID, upid.PStart, upid.StartTime, upid.Type, upid.ID, upid.User)
+}
+
+// IsZero reports whether the UPID is empty
+func (upid UPID) IsZero() bool {
+	return upid == UPID{}
+}
+
+// VMID returns the ID of the VM the task works on. It returns false for tasks that do not work on a VM.
+func (upid UPID) VMID() (int64, bool) {
+	id, err := strconv.ParseInt(upid.ID, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// Started returns when the task was started
+func (upid UPID) Started() time.Time {
+	return time.Unix(upid.StartTime, 0)
+}
+
+func (upid UPID) MarshalText() ([]byte, error) {
+	if upid.IsZero() {
+		return []byte{}, nil
+	}
+	return []byte(upid.String()), nil
+}
+
+// UnmarshalText parses the UPID, so it can be used directly in models unmarshalled from JSON
+func (upid *UPID) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*upid = UPID{}
+		return nil
+	}
+
+	parsed, err := ParseUPID(string(text))
+	if err != nil {
+		return err
+	}
+
+	*upid = parsed
+	return nil
+}
+
+// path returns the API path of the task
+func (upid UPID) path() string {
+	return NodesPath + "/" + upid.Node + taskPath + "/" + upid.String()
+}
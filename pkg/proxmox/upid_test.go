@@ -0,0 +1,82 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseUPID(t *testing.T) {
+	upid, err := ParseUPID(testUPID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if upid != testTaskUPID {
+		t.Errorf("Expected %+v, got %+v", testTaskUPID, upid)
+	}
+
+	if upid.String() != testUPID {
+		t.Errorf("Expected the UPID to format as %q, got %q", testUPID, upid.String())
+	}
+
+	vmid, ok := upid.VMID()
+	if !ok || vmid != 102 {
+		t.Errorf("Expected VMID 102, got %d", vmid)
+	}
+
+	if upid.Started().Unix() != 0x65A1B2C3 {
+		t.Errorf("Expected the start time to be parsed, got %v", upid.Started())
+	}
+}
+
+func TestParseUPIDWithoutID(t *testing.T) {
+	upid, err := ParseUPID("UPID:pve:000A1B2C:0003D4E5:65A1B2C3:srvreload:networking:root@pam!ci:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if upid.User != "root@pam!ci" || upid.Type != "srvreload" {
+		t.Errorf("Unexpected UPID %+v", upid)
+	}
+
+	if _, ok := upid.VMID(); ok {
+		t.Error("Expected no VMID for a network reload")
+	}
+}
+
+func TestParseInvalidUPID(t *testing.T) {
+	for _, upid := range []string{
+		"",
+		"UPID:pve:00001234:00005678:65A1B2C3:qmcreate:102:root@pam",
+		"TASK:pve:00001234:00005678:65A1B2C3:qmcreate:102:root@pam:",
+		"UPID:pve:not-hex:00005678:65A1B2C3:qmcreate:102:root@pam:",
+		"UPID:pve:00001234:00005678:65a1b2c3:qmcreate:102:root@pam:",
+		"UPID:pve:1234:00005678:65A1B2C3:qmcreate:102:root@pam:",
+		"UPID::00001234:00005678:65A1B2C3:qmcreate:102:root@pam:",
+	} {
+		if _, err := ParseUPID(upid); err == nil {
+			t.Errorf("Expected %q to be rejected", upid)
+		}
+	}
+}
+
+func TestUPIDJSON(t *testing.T) {
+	task := Task{}
+	err := json.Unmarshal([]byte(`{"upid":"`+testUPID+`","status":"running"}`), &task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.UPID != testTaskUPID {
+		t.Errorf("Expected the UPID to be parsed, got %+v", task.UPID)
+	}
+
+	body, err := json.Marshal(task.UPID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != `"`+testUPID+`"` {
+		t.Errorf("Expected the UPID to be marshalled as a string, got %s", body)
+	}
+}
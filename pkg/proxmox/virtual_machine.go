@@ -1,153 +1,172 @@
 package proxmox
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/clincha-org/proxmox-api/pkg/cloudinit"
+	"github.com/clincha-org/proxmox-api/pkg/efidisk"
 	"github.com/clincha-org/proxmox-api/pkg/ide"
-	"io"
-	"log/slog"
-	"net/http"
+	"github.com/clincha-org/proxmox-api/pkg/netdev"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+	"github.com/clincha-org/proxmox-api/pkg/sata"
+	"github.com/clincha-org/proxmox-api/pkg/scsi"
+	"github.com/clincha-org/proxmox-api/pkg/tpmstate"
+	"github.com/clincha-org/proxmox-api/pkg/virtio"
+	"maps"
 	"regexp"
+	"slices"
 	"strconv"
-	"time"
+	"strings"
 )
 
 const VirtualMachinePath = "/qemu"
 
-func (client *Client) GetVM(node string, id int64) (VirtualMachine, error) {
-	request, err := http.NewRequest(
-		"GET",
-		client.Host+ApiPath+NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10)+"/config",
-		nil,
-	)
+func (client *Client) GetVM(ctx context.Context, node string, id int64) (VirtualMachine, error) {
+	vmModel, err := client.getVMConfig(ctx, node, id)
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("GetVM-build-request: %w", err)
+		return VirtualMachine{}, fmt.Errorf("GetVM-config: %w", err)
 	}
 
-	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
-	request.Header.Set("CSRFPreventionToken", client.Ticket.Data.CSRFPreventionToken)
+	vm := newVirtualMachine(id, &vmModel)
 
-	response, err := client.HTTPClient.Do(request)
+	vm.CloudInit, err = parseCloudInit(&vmModel)
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("GetVM-do-request: %w", err)
+		return VirtualMachine{}, fmt.Errorf("GetVM-cloud-init: %w", err)
 	}
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("GetVM-read-response: %w", err)
+	// The cloud-init drive is part of CloudInit, so it is left out of the disks
+	devices := maps.Clone(vmModel.Devices)
+	if vm.CloudInit != nil && vm.CloudInit.Drive != nil {
+		delete(devices, vm.CloudInit.Drive.Setting)
 	}
 
-	err = response.Body.Close()
-	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("GetVM-close-response: %w", err)
-	}
+	var IdeDevices []ide.InternalDataStorage
+	for index, IDEDeviceString := range []*string{vmModel.IDE0, vmModel.IDE1, vmModel.IDE2, vmModel.IDE3} {
+		if IDEDeviceString == nil || cloudinit.IsDrive(*IDEDeviceString) {
+			continue
+		}
 
-	slog.Debug("api-response", "method", "GetVM", "node", node, "status", response.Status, "response", string(body))
+		client.Logger.Debug("ide-unmarshal", "data", *IDEDeviceString)
 
-	if response.StatusCode != http.StatusOK {
-		return VirtualMachine{}, fmt.Errorf("GetVM-status-error: %s %s", response.Status, body)
+		device := ide.InternalDataStorage{}
+		err := ide.Unmarshal(int64(index), *IDEDeviceString, &device)
+		if err != nil {
+			return VirtualMachine{}, err
+		}
+		IdeDevices = append(IdeDevices, device)
 	}
+	vm.IDEDevices = &IdeDevices
 
-	vmModel := VirtualMachineConfigResponse{}
-
-	// The API returns numbers with and without quotes, so we quote all numbers to make it easier to unmarshal
-	re := regexp.MustCompile(`(":\s*)([\d.]+)(\s*[,}])`)
-	body = re.ReplaceAll(body, []byte(`$1"$2"$3`))
+	vm.NetworkDevices, err = parseDevices("net", netdev.MaxID, devices, netdev.Unmarshal)
+	if err != nil {
+		return VirtualMachine{}, fmt.Errorf("GetVM-network-devices: %w", err)
+	}
 
-	slog.Debug("api-response-quoted", "method", "GetVM", "node", node, "response", string(body))
+	vm.SCSIDevices, err = parseDevices("scsi", scsi.MaxID, devices, scsi.Unmarshal)
+	if err != nil {
+		return VirtualMachine{}, fmt.Errorf("GetVM-scsi-devices: %w", err)
+	}
 
-	err = json.Unmarshal(body, &vmModel)
+	vm.VirtIODevices, err = parseDevices("virtio", virtio.MaxID, devices, virtio.Unmarshal)
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("GetVM-unmarshal-response: %w", err)
+		return VirtualMachine{}, fmt.Errorf("GetVM-virtio-devices: %w", err)
 	}
 
-	vm := VirtualMachine{
-		ID:           id,
-		Net1:         &vmModel.Data.Net1,
-		SCSIHardware: &vmModel.Data.Scsihw,
-		Cores:        vmModel.Data.Cores,
-		Memory:       vmModel.Data.Memory,
+	vm.SATADevices, err = parseDevices("sata", sata.MaxID, devices, sata.Unmarshal)
+	if err != nil {
+		return VirtualMachine{}, fmt.Errorf("GetVM-sata-devices: %w", err)
 	}
 
-	var IdeDevices []ide.InternalDataStorage
-	for index, IDEDeviceString := range []*string{vmModel.Data.IDE0, vmModel.Data.IDE1, vmModel.Data.IDE2, vmModel.Data.IDE3} {
-		if IDEDeviceString == nil {
-			continue
+	if vmModel.EFIDisk0 != nil {
+		vm.EFIDisk = &efidisk.Disk{}
+		err = efidisk.Unmarshal(*vmModel.EFIDisk0, vm.EFIDisk)
+		if err != nil {
+			return VirtualMachine{}, fmt.Errorf("GetVM-efi-disk: %w", err)
 		}
+	}
 
-		device := ide.InternalDataStorage{}
-		err := ide.Unmarshal(int64(index), *IDEDeviceString, &device)
+	if vmModel.TPMState0 != nil {
+		vm.TPMState = &tpmstate.State{}
+		err = tpmstate.Unmarshal(*vmModel.TPMState0, vm.TPMState)
 		if err != nil {
-			return VirtualMachine{}, err
+			return VirtualMachine{}, fmt.Errorf("GetVM-tpm-state: %w", err)
 		}
-		IdeDevices = append(IdeDevices, device)
 	}
-	vm.IDEDevices = &IdeDevices
 
 	return vm, nil
 }
 
-func (client *Client) GetVMs(node string) ([]VirtualMachineListItem, error) {
-	request, err := http.NewRequest(
-		"GET",
-		client.Host+ApiPath+NodesPath+"/"+node+VirtualMachinePath,
-		nil,
-	)
+// getVMConfig reads the configuration of the VM
+func (client *Client) getVMConfig(ctx context.Context, node string, id int64) (VirtualMachineConfig, error) {
+	vmModel := VirtualMachineConfig{}
+
+	body, err := do[json.RawMessage](ctx, client, "GET", NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10)+"/config", nil, nil)
 	if err != nil {
-		return []VirtualMachineListItem{}, fmt.Errorf("GetVMs-build-request: %w", err)
+		return vmModel, fmt.Errorf("getVMConfig-request: %w", err)
 	}
 
-	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
-	request.Header.Set("CSRFPreventionToken", client.Ticket.Data.CSRFPreventionToken)
+	// The API returns numbers with and without quotes, so we quote all numbers to make it easier to unmarshal
+	re := regexp.MustCompile(`(":\s*)([\d.]+)(\s*[,}])`)
+	body = re.ReplaceAll(body, []byte(`$1"$2"$3`))
+
+	client.Logger.Debug("api-response-quoted", "method", "GetVM", "node", node, "response", string(body))
 
-	response, err := client.HTTPClient.Do(request)
+	err = json.Unmarshal(body, &vmModel)
 	if err != nil {
-		return []VirtualMachineListItem{}, fmt.Errorf("GetVMs-do-request: %w", err)
+		return vmModel, fmt.Errorf("getVMConfig-unmarshal-response: %w", err)
 	}
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return []VirtualMachineListItem{}, fmt.Errorf("GetVMs-read-response: %w", err)
-	}
+	return vmModel, nil
+}
 
-	err = response.Body.Close()
+func (client *Client) GetVMs(ctx context.Context, node string) ([]VirtualMachineListItem, error) {
+	vms, err := do[[]VirtualMachineListItem](ctx, client, "GET", NodesPath+"/"+node+VirtualMachinePath, nil, nil)
 	if err != nil {
-		return []VirtualMachineListItem{}, fmt.Errorf("GetVMs-close-response: %w", err)
+		return []VirtualMachineListItem{}, fmt.Errorf("GetVMs-request: %w", err)
 	}
 
-	slog.Debug("api-response", "method", "GetVMs", "node", node, "status", response.Status, "response", string(body))
+	return vms, nil
+}
+
+// CreateVM creates the VM and waits for Proxmox to finish configuring it. An EFI disk requires BIOS to be ovmf,
+// otherwise ErrEFIDiskRequiresOVMF is returned.
+func (client *Client) CreateVM(ctx context.Context, node string, vm *VirtualMachine, start bool) (VirtualMachine, error) {
+	vmRequest := newVirtualMachineRequest(vm)
+
+	// Empty settings are the same as unset ones when creating a VM
+	vmRequest.emptySettings()
 
-	if response.StatusCode != http.StatusOK {
-		return []VirtualMachineListItem{}, fmt.Errorf("GetVMs-status-error: %s %s", response.Status, body)
+	err := checkFirmware(vm.BIOS, vm.EFIDisk != nil && vm.EFIDisk.Storage != "")
+	if err != nil {
+		return VirtualMachine{}, fmt.Errorf("CreateVM-firmware: %w", err)
 	}
 
-	vmModel := VirtualMachinesResponse{}
-	err = json.Unmarshal(body, &vmModel)
+	devices, err := vm.deviceSettings()
 	if err != nil {
-		return []VirtualMachineListItem{}, fmt.Errorf("GetVMs-unmarshal-response: %w", err)
+		return VirtualMachine{}, fmt.Errorf("CreateVM-devices: %w", err)
+	}
+	for prefix, settings := range devices {
+		vmRequest.setDevices(prefix, settings, nil)
 	}
 
-	return vmModel.Data, nil
-}
+	_, err = vmRequest.setFirmware(vm, nil)
+	if err != nil {
+		return VirtualMachine{}, fmt.Errorf("CreateVM-firmware: %w", err)
+	}
 
-func (client *Client) CreateVM(node string, vm *VirtualMachine, start bool) (VirtualMachine, error) {
-	vmRequest := VirtualMachineRequest{
-		ID:           vm.ID,
-		SCSI1:        vm.SCSI1,
-		Net1:         vm.Net1,
-		SCSIHardware: vm.SCSIHardware,
-		Cores:        vm.Cores,
-		Memory:       vm.Memory,
+	var ideDevices []ide.InternalDataStorage
+	if vm.IDEDevices != nil {
+		ideDevices = *vm.IDEDevices
 	}
 
-	if len(*vm.IDEDevices) > 4 {
-		return VirtualMachine{}, fmt.Errorf("CreateVM-invalid-number-of-ide-devices: %d. Proxmox only allows 4 IDE devices", len(*vm.IDEDevices))
+	if len(ideDevices) > 4 {
+		return VirtualMachine{}, fmt.Errorf("CreateVM-invalid-number-of-ide-devices: %d. Proxmox only allows 4 IDE devices", len(ideDevices))
 	}
 
-	for _, ideDevice := range *vm.IDEDevices {
+	for _, ideDevice := range ideDevices {
 
-		slog.Debug("ide-device", "device", ideDevice)
+		client.Logger.Debug("ide-device", "device", ideDevice)
 
 		if ideDevice.ID > 3 || ideDevice.ID < 0 {
 			return VirtualMachine{}, fmt.Errorf("CreateVM-invalid-ide-device: %d", ideDevice.ID)
@@ -170,199 +189,519 @@ func (client *Client) CreateVM(node string, vm *VirtualMachine, start bool) (Vir
 		}
 	}
 
-	requestBody, err := json.Marshal(vmRequest)
+	_, err = vmRequest.setCloudInitDrive(vm, nil, nil)
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("CreateVM-marshal-request: %w", err)
+		return VirtualMachine{}, fmt.Errorf("CreateVM-cloud-init-drive: %w", err)
 	}
 
-	request, err := http.NewRequest(
-		"POST",
-		client.Host+ApiPath+NodesPath+"/"+node+VirtualMachinePath,
-		bytes.NewBuffer(requestBody),
-	)
+	upid, err := do[UPID](ctx, client, "POST", NodesPath+"/"+node+VirtualMachinePath, nil, vmRequest)
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("CreateVM-build-request: %w", err)
+		return VirtualMachine{}, fmt.Errorf("CreateVM-request: %w", err)
 	}
 
-	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
-	request.Header.Set("CSRFPreventionToken", client.Ticket.Data.CSRFPreventionToken)
-	request.Header.Set("Content-Type", "application/json")
+	// Make sure the VM has finished configuring before returning
+	_, err = client.WaitForTask(ctx, upid, TaskWaitOptions{})
+	if err != nil {
+		return VirtualMachine{}, fmt.Errorf("CreateVM-wait-for-task: %w", err)
+	}
 
-	response, err := client.HTTPClient.Do(request)
+	if start {
+		_, err = client.StartVM(ctx, node, vm.ID, PowerOptions{Wait: true})
+		if err != nil {
+			return VirtualMachine{}, fmt.Errorf("CreateVM-start-vm: %w", err)
+		}
+	}
+
+	return client.GetVM(ctx, node, vm.ID)
+}
+
+// UpdateVM changes the settings of the VM that are set. Settings set to an empty string or an empty list of tags are
+// removed from the configuration. Network devices and disks that are not in their list are removed, Proxmox keeps
+// removed disks as unused disks. Disks are not resized. IDE devices are not changed.
+// ErrEFIDiskRequiresOVMF is returned when the VM would be left with an EFI disk but without the ovmf bios.
+func (client *Client) UpdateVM(ctx context.Context, node string, vm *VirtualMachine) (VirtualMachine, error) {
+	vmRequest := newVirtualMachineRequest(vm)
+
+	// Proxmox rejects empty values, settings are removed by listing them in delete instead
+	deleted := vmRequest.emptySettings()
+
+	devices, err := vm.deviceSettings()
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("CreateVM-do-request: %w", err)
+		return VirtualMachine{}, fmt.Errorf("UpdateVM-devices: %w", err)
 	}
 
-	body, err := io.ReadAll(response.Body)
+	cloudInitDrive := vm.CloudInit != nil && vm.CloudInit.Drive != nil
+	if len(devices) > 0 || vm.EFIDisk != nil || vm.TPMState != nil || vm.BIOS != nil || cloudInitDrive {
+		current, err := client.getVMConfig(ctx, node, vm.ID)
+		if err != nil {
+			return VirtualMachine{}, fmt.Errorf("UpdateVM-current-config: %w", err)
+		}
+
+		// Check the firmware the VM ends up with, combining the changes with the current configuration
+		bios := current.BIOS
+		if vm.BIOS != nil {
+			bios = vm.BIOS
+		}
+		hasEFIDisk := current.EFIDisk0 != nil
+		if vm.EFIDisk != nil {
+			hasEFIDisk = vm.EFIDisk.Storage != ""
+		}
+		err = checkFirmware(bios, hasEFIDisk)
+		if err != nil {
+			return VirtualMachine{}, fmt.Errorf("UpdateVM-firmware: %w", err)
+		}
+
+		for prefix, settings := range devices {
+			deleted = append(deleted, vmRequest.setDevices(prefix, settings, current.Devices)...)
+		}
+
+		removed, err := vmRequest.setFirmware(vm, &current)
+		if err != nil {
+			return VirtualMachine{}, fmt.Errorf("UpdateVM-firmware: %w", err)
+		}
+		deleted = append(deleted, removed...)
+
+		removed, err = vmRequest.setCloudInitDrive(vm, &current, deleted)
+		if err != nil {
+			return VirtualMachine{}, fmt.Errorf("UpdateVM-cloud-init-drive: %w", err)
+		}
+		deleted = append(deleted, removed...)
+	}
+	if len(deleted) > 0 {
+		joined := strings.Join(deleted, ",")
+		vmRequest.Delete = &joined
+	}
+
+	_, err = do[any](ctx, client, "PUT", NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(vm.ID, 10)+"/config", nil, vmRequest)
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("CreateVM-read-response: %w", err)
+		return VirtualMachine{}, fmt.Errorf("UpdateVM-request: %w", err)
 	}
 
-	err = response.Body.Close()
+	return client.GetVM(ctx, node, vm.ID)
+}
+
+// RegenerateCloudInit rebuilds the cloud-init image of the VM from its current settings. Proxmox otherwise only
+// rebuilds the image when the VM starts.
+func (client *Client) RegenerateCloudInit(ctx context.Context, node string, id int64) error {
+	_, err := do[any](ctx, client, "PUT", NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10)+"/cloudinit", nil, nil)
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("CreateVM-close-response: %w", err)
+		return fmt.Errorf("RegenerateCloudInit-request: %w", err)
 	}
 
-	slog.Debug("api-response", "method", "CreateVM", "node", node, "status", response.Status, "response", string(body))
+	return nil
+}
+
+func (client *Client) DeleteVM(ctx context.Context, node string, id int64) error {
 
-	if response.StatusCode != http.StatusOK {
-		return VirtualMachine{}, fmt.Errorf("CreateVM-status-error: %s %s", response.Status, body)
+	// Check if the VM is still running
+	vmStatus, err := client.GetVMStatus(ctx, node, id)
+	if err != nil {
+		return fmt.Errorf("DeleteVM-get-vm-status: %w", err)
 	}
 
-	if start {
-		err = client.StartVm(node, vm.ID)
+	if vmStatus.Status != "stopped" {
+		// Stop the VM and wait until it has stopped
+		_, err = client.StopVM(ctx, node, id, PowerOptions{Wait: true})
 		if err != nil {
-			return VirtualMachine{}, fmt.Errorf("CreateVM-start-vm: %w", err)
+			return fmt.Errorf("DeleteVM-stop-vm: %w", err)
 		}
 	}
 
-	// Make sure the VM has finished configuring before returning
-	// Get the task ID from the response
-	job := JobResponse{}
-	err = json.Unmarshal(body, &job)
+	// Once the VM is stopped, delete it
+	upid, err := do[UPID](ctx, client, "DELETE", NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10), nil, nil)
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("CreateVM-unmarshal-response: %w", err)
+		return fmt.Errorf("DeleteVM-request: %w", err)
 	}
-	// Get the task status
-	task, err := client.GetTask(node, job.ID)
+
+	// Make sure the VM has finished being removed before returning
+	_, err = client.WaitForTask(ctx, upid, TaskWaitOptions{})
 	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("CreateVM-get-task: %w", err)
+		return fmt.Errorf("DeleteVM-wait-for-task: %w", err)
 	}
-	// Poll the task status until the task is completed
-	for ok := true; ok; ok = task.Status != "stopped" {
-		task, err = client.GetTask(node, job.ID)
-		if err != nil {
-			return VirtualMachine{}, fmt.Errorf("CreateVM-get-job-loop: %w", err)
+
+	return nil
+}
+
+// newVirtualMachineRequest converts the settings of the VM to the parameters the API expects, IDE devices are left out
+func newVirtualMachineRequest(vm *VirtualMachine) VirtualMachineRequest {
+	request := VirtualMachineRequest{
+		ID:           vm.ID,
+		Name:         vm.Name,
+		Description:  vm.Description,
+		SCSIHardware: vm.SCSIHardware,
+		Sockets:      vm.Sockets,
+		Cores:        vm.Cores,
+		VCPUs:        vm.VCPUs,
+		CPU:          vm.CPU,
+		CPULimit:     vm.CPULimit,
+		CPUUnits:     vm.CPUUnits,
+		Numa:         vm.Numa,
+		Memory:       vm.Memory,
+		Balloon:      vm.Balloon,
+		BIOS:         vm.BIOS,
+		Machine:      vm.Machine,
+		OSType:       vm.OSType,
+		Boot:         vm.Boot,
+		Agent:        vm.Agent,
+		OnBoot:       vm.OnBoot,
+		Startup:      vm.Startup,
+		Protection:   vm.Protection,
+		Hotplug:      vm.Hotplug,
+		KVM:          vm.KVM,
+		ACPI:         vm.ACPI,
+		Tablet:       vm.Tablet,
+		LocalTime:    vm.LocalTime,
+		VGA:          vm.VGA,
+	}
+
+	if vm.Tags != nil {
+		tags := strings.Join(*vm.Tags, ";")
+		request.Tags = &tags
+	}
+
+	if vm.CloudInit != nil {
+		request.CIUser = vm.CloudInit.User
+		request.CIPassword = vm.CloudInit.Password
+		request.Nameserver = vm.CloudInit.Nameserver
+		request.SearchDomain = vm.CloudInit.SearchDomain
+		request.CICustom = vm.CloudInit.Custom
+
+		if vm.CloudInit.SSHKeys != nil {
+			keys := cloudinit.EncodeSSHKeys(*vm.CloudInit.SSHKeys)
+			request.SSHKeys = &keys
 		}
-		// Sleep for 1 second before polling again
-		time.Sleep(1 * time.Second)
 	}
 
-	return client.GetVM(node, vm.ID)
+	return request
 }
 
-func (client *Client) UpdateVM(node string, vmRequest *VirtualMachine) (VirtualMachine, error) {
-	requestBody, err := json.Marshal(vmRequest)
-	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("UpdateVM-marshal-request: %w", err)
+// emptySettings unsets the settings that are set to an empty string and returns their names, sorted
+func (request *VirtualMachineRequest) emptySettings() []string {
+	settings := map[string]**string{
+		"name":         &request.Name,
+		"description":  &request.Description,
+		"tags":         &request.Tags,
+		"scsihw":       &request.SCSIHardware,
+		"cpu":          &request.CPU,
+		"bios":         &request.BIOS,
+		"machine":      &request.Machine,
+		"ostype":       &request.OSType,
+		"boot":         &request.Boot,
+		"agent":        &request.Agent,
+		"startup":      &request.Startup,
+		"hotplug":      &request.Hotplug,
+		"vga":          &request.VGA,
+		"ciuser":       &request.CIUser,
+		"cipassword":   &request.CIPassword,
+		"sshkeys":      &request.SSHKeys,
+		"nameserver":   &request.Nameserver,
+		"searchdomain": &request.SearchDomain,
+		"cicustom":     &request.CICustom,
+	}
+
+	var empty []string
+	for name, setting := range settings {
+		if *setting != nil && **setting == "" {
+			*setting = nil
+			empty = append(empty, name)
+		}
 	}
+	slices.Sort(empty)
 
-	request, err := http.NewRequest(
-		"PUT",
-		client.Host+ApiPath+NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(vmRequest.ID, 10)+"/config",
-		bytes.NewBuffer(requestBody),
-	)
-	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("UpdateVM-build-request: %w", err)
-	}
+	return empty
+}
+
+// newVirtualMachine converts the configuration returned by the API to the VM model, IDE devices are left out
+func newVirtualMachine(id int64, config *VirtualMachineConfig) VirtualMachine {
+	vm := VirtualMachine{
+		ID:           id,
+		Name:         config.Name,
+		Description:  config.Description,
+		SCSIHardware: config.Scsihw,
+		Sockets:      config.Sockets,
+		Cores:        config.Cores,
+		VCPUs:        config.VCPUs,
+		CPU:          config.Cpu,
+		CPULimit:     config.CPULimit,
+		CPUUnits:     config.CPUUnits,
+		Numa:         intToBool(config.Numa),
+		Memory:       config.Memory,
+		Balloon:      config.Balloon,
+		BIOS:         config.BIOS,
+		Machine:      config.Machine,
+		OSType:       config.Ostype,
+		Boot:         config.Boot,
+		Agent:        config.Agent,
+		OnBoot:       intToBool(config.OnBoot),
+		Startup:      config.Startup,
+		Protection:   intToBool(config.Protection),
+		Hotplug:      config.Hotplug,
+		KVM:          intToBool(config.KVM),
+		ACPI:         intToBool(config.ACPI),
+		Tablet:       intToBool(config.Tablet),
+		LocalTime:    intToBool(config.LocalTime),
+		VGA:          config.VGA,
+		Template:     intToBool(config.Template),
+	}
+
+	if config.Tags != nil {
+		// Proxmox separates tags with semicolons, but accepts commas and spaces as well
+		tags := strings.FieldsFunc(*config.Tags, func(r rune) bool {
+			return r == ';' || r == ',' || r == ' '
+		})
+		vm.Tags = &tags
+	}
+
+	return vm
+}
 
-	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
-	request.Header.Set("CSRFPreventionToken", client.Ticket.Data.CSRFPreventionToken)
-	request.Header.Set("Content-Type", "application/json")
+// deviceSettings marshals the lists of numbered devices that are set, keyed by the prefix of their settings
+func (vm *VirtualMachine) deviceSettings() (map[string]map[string]string, error) {
+	devices := map[string]map[string]string{}
 
-	response, err := client.HTTPClient.Do(request)
-	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("UpdateVM-do-request: %w", err)
+	if vm.NetworkDevices != nil {
+		settings, err := marshalDevices("net", *vm.NetworkDevices, func(device netdev.NetworkDevice) int64 { return device.ID }, netdev.Marshal)
+		if err != nil {
+			return nil, err
+		}
+		devices["net"] = settings
 	}
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("UpdateVM-read-response: %w", err)
+	if vm.SCSIDevices != nil {
+		settings, err := marshalDevices("scsi", *vm.SCSIDevices, func(device scsi.Disk) int64 { return device.ID }, scsi.Marshal)
+		if err != nil {
+			return nil, err
+		}
+		devices["scsi"] = settings
 	}
 
-	err = response.Body.Close()
-	if err != nil {
-		return VirtualMachine{}, fmt.Errorf("UpdateVM-close-response: %w", err)
+	if vm.VirtIODevices != nil {
+		settings, err := marshalDevices("virtio", *vm.VirtIODevices, func(device virtio.Disk) int64 { return device.ID }, virtio.Marshal)
+		if err != nil {
+			return nil, err
+		}
+		devices["virtio"] = settings
 	}
 
-	slog.Debug("api-response", "method", "UpdateVM", "node", node, "status", response.Status, "response", string(body))
+	if vm.SATADevices != nil {
+		settings, err := marshalDevices("sata", *vm.SATADevices, func(device sata.Disk) int64 { return device.ID }, sata.Marshal)
+		if err != nil {
+			return nil, err
+		}
+		devices["sata"] = settings
+	}
 
-	if response.StatusCode != http.StatusOK {
-		return VirtualMachine{}, fmt.Errorf("UpdateVM-status-error: %s %s", response.Status, body)
+	if vm.CloudInit != nil && vm.CloudInit.IPConfigs != nil {
+		settings, err := marshalDevices("ipconfig", *vm.CloudInit.IPConfigs, func(config cloudinit.IPConfig) int64 { return config.ID }, cloudinit.MarshalIPConfig)
+		if err != nil {
+			return nil, err
+		}
+		devices["ipconfig"] = settings
 	}
 
-	return client.GetVM(node, vmRequest.ID)
+	return devices, nil
 }
 
-func (client *Client) DeleteVM(node string, id int64) error {
+// marshalDevices marshals the devices, keyed by their setting, for example net0
+func marshalDevices[T any](prefix string, devices []T, id func(T) int64, marshal func(*T) (string, error)) (map[string]string, error) {
+	settings := map[string]string{}
+	for _, device := range devices {
+		setting := prefix + strconv.FormatInt(id(device), 10)
+		if _, exists := settings[setting]; exists {
+			return nil, fmt.Errorf("device %s is listed more than once", setting)
+		}
 
-	// Check if the VM is still running
-	vmStatus, err := client.GetVMStatus(node, id)
-	if err != nil {
-		return fmt.Errorf("DeleteVM-get-vm-status: %w", err)
+		data, err := marshal(&device)
+		if err != nil {
+			return nil, err
+		}
+		settings[setting] = data
 	}
+	return settings, nil
+}
 
-	if vmStatus.Status != "stopped" {
-		// Stop the VM
-		err = client.StopVM(node, id)
+// parseDevices unmarshals the devices with the prefix from the settings of the VM, ordered by their number
+func parseDevices[T any](prefix string, maxID int64, settings map[string]string, unmarshal func(int64, string, *T) error) (*[]T, error) {
+	devices := []T{}
+	for index := int64(0); index <= maxID; index++ {
+		data, ok := settings[prefix+strconv.FormatInt(index, 10)]
+		if !ok {
+			continue
+		}
+
+		var device T
+		err := unmarshal(index, data, &device)
 		if err != nil {
-			return fmt.Errorf("DeleteVM-stop-vm: %w", err)
+			return nil, err
 		}
+		devices = append(devices, device)
+	}
+	return &devices, nil
+}
+
+// setDevices adds the numbered devices with the prefix to the request. When the current devices of the VM are given,
+// devices that have not changed are left out and the names of the devices that are no longer listed are returned,
+// so they can be deleted. The cloud-init drive is never removed, see setCloudInitDrive.
+func (request *VirtualMachineRequest) setDevices(prefix string, devices map[string]string, current map[string]string) []string {
+	if request.Devices == nil {
+		request.Devices = map[string]string{}
+	}
+
+	for setting, data := range devices {
+		if !propstring.Equal(current[setting], data) {
+			request.Devices[setting] = data
+		}
+	}
+
+	numbered := regexp.MustCompile(`^` + prefix + `\d+$`)
+
+	var removed []string
+	for setting := range current {
+		if _, listed := devices[setting]; !listed && numbered.MatchString(setting) && !cloudinit.IsDrive(current[setting]) {
+			removed = append(removed, setting)
+		}
+	}
+	slices.Sort(removed)
+
+	return removed
+}
 
-		// Poll the VM status until it is stopped
-		for ok := true; ok; ok = vmStatus.Status != "stopped" {
-			vmStatus, err = client.GetVMStatus(node, id)
+// setFirmware adds the EFI disk and TPM state of the VM to the request. When the current configuration of the VM is
+// given, settings that have not changed are left out and the names of the settings to remove are returned.
+func (request *VirtualMachineRequest) setFirmware(vm *VirtualMachine, current *VirtualMachineConfig) ([]string, error) {
+	var removed []string
+
+	if vm.EFIDisk != nil {
+		if vm.EFIDisk.Storage == "" {
+			if current != nil && current.EFIDisk0 != nil {
+				removed = append(removed, "efidisk0")
+			}
+		} else {
+			data, err := efidisk.Marshal(vm.EFIDisk)
 			if err != nil {
-				return fmt.Errorf("DeleteVM-get-vm-status-loop: %w", err)
+				return nil, err
+			}
+			if current == nil || current.EFIDisk0 == nil || !propstring.Equal(*current.EFIDisk0, data) {
+				request.EFIDisk0 = &data
 			}
 		}
 	}
 
-	// Once the VM is stopped, delete it
-	request, err := http.NewRequest(
-		"DELETE",
-		client.Host+ApiPath+NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10),
-		nil,
-	)
-	if err != nil {
-		return fmt.Errorf("DeleteVM-build-request: %w", err)
+	if vm.TPMState != nil {
+		if vm.TPMState.Storage == "" {
+			if current != nil && current.TPMState0 != nil {
+				removed = append(removed, "tpmstate0")
+			}
+		} else {
+			data, err := tpmstate.Marshal(vm.TPMState)
+			if err != nil {
+				return nil, err
+			}
+			if current == nil || current.TPMState0 == nil || !propstring.Equal(*current.TPMState0, data) {
+				request.TPMState0 = &data
+			}
+		}
 	}
 
-	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
-	request.Header.Set("CSRFPreventionToken", client.Ticket.Data.CSRFPreventionToken)
+	return removed, nil
+}
 
-	response, err := client.HTTPClient.Do(request)
-	if err != nil {
-		return fmt.Errorf("DeleteVM-do-request: %w", err)
+// setCloudInitDrive adds the cloud-init drive of the VM to the request. When the current configuration of the VM is
+// given, a drive that is already in place is left out and the settings to remove are returned, which is the current
+// drive when it is removed or moved. The drive cannot take the place of another device unless it is being deleted.
+func (request *VirtualMachineRequest) setCloudInitDrive(vm *VirtualMachine, current *VirtualMachineConfig, deleted []string) ([]string, error) {
+	if vm.CloudInit == nil || vm.CloudInit.Drive == nil {
+		return nil, nil
 	}
+	drive := vm.CloudInit.Drive
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return fmt.Errorf("DeleteVM-read-response: %w", err)
+	var currentDrive *cloudinit.Drive
+	if current != nil {
+		currentDrive = current.cloudInitDrive()
 	}
 
-	err = response.Body.Close()
-	if err != nil {
-		return fmt.Errorf("DeleteVM-close-response: %w", err)
+	if drive.Storage == "" {
+		if currentDrive != nil {
+			return []string{currentDrive.Setting}, nil
+		}
+		return nil, nil
 	}
 
-	slog.Debug("api-response", "method", "DeleteVM", "node", node, "status", response.Status, "response", string(body))
+	if !cloudinit.DriveSetting.MatchString(drive.Setting) {
+		return nil, fmt.Errorf("invalid setting for the cloud-init drive: %q", drive.Setting)
+	}
 
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("DeleteVM-status-error: %s %s", response.Status, body)
+	if currentDrive != nil && *currentDrive == *drive {
+		return nil, nil
 	}
 
-	// Make sure the VM has finished configuring before returning
-	// Get the task ID from the response
-	job := JobResponse{}
-	err = json.Unmarshal(body, &job)
-	if err != nil {
-		return fmt.Errorf("DeleteVM-unmarshal-response: %w", err)
+	ideSettings := map[string]*string{"ide0": request.IDE0, "ide1": request.IDE1, "ide2": request.IDE2, "ide3": request.IDE3}
+	_, requested := request.Devices[drive.Setting]
+	inUse := requested || ideSettings[drive.Setting] != nil
+	movedOrAdded := currentDrive == nil || currentDrive.Setting != drive.Setting
+	if current != nil && movedOrAdded && !slices.Contains(deleted, drive.Setting) {
+		inUse = inUse || current.setting(drive.Setting) != nil
 	}
-	// Get the task status
-	task, err := client.GetTask(node, job.ID)
+	if inUse {
+		return nil, fmt.Errorf("%s is already used by another device", drive.Setting)
+	}
+
+	if request.Devices == nil {
+		request.Devices = map[string]string{}
+	}
+	request.Devices[drive.Setting] = cloudinit.DriveValue(drive.Storage)
+
+	if currentDrive != nil && currentDrive.Setting != drive.Setting {
+		return []string{currentDrive.Setting}, nil
+	}
+	return nil, nil
+}
+
+// parseCloudInit reads the cloud-init settings and drive from the configuration, it returns nil when there are none
+func parseCloudInit(config *VirtualMachineConfig) (*cloudinit.CloudInit, error) {
+	ipConfigs, err := parseDevices("ipconfig", cloudinit.MaxIPConfigID, config.Devices, cloudinit.UnmarshalIPConfig)
 	if err != nil {
-		return fmt.Errorf("DeleteVM-get-task: %w", err)
+		return nil, err
+	}
+
+	cloudInit := cloudinit.CloudInit{
+		User:         config.CIUser,
+		Nameserver:   config.Nameserver,
+		SearchDomain: config.Searchdomain,
+		Custom:       config.CICustom,
+		IPConfigs:    ipConfigs,
+		Drive:        config.cloudInitDrive(),
 	}
-	// Poll the task status until the task is completed
-	for ok := true; ok; ok = task.Status != "stopped" {
-		task, err = client.GetTask(node, job.ID)
+
+	if config.SSHKeys != nil {
+		keys, err := cloudinit.DecodeSSHKeys(*config.SSHKeys)
 		if err != nil {
-			return fmt.Errorf("DeleteVM-get-job-loop: %w", err)
+			return nil, err
 		}
-		// Sleep for 1 second before polling again
-		time.Sleep(1 * time.Second)
+		cloudInit.SSHKeys = &keys
+	}
+
+	if cloudInit.Drive == nil && len(*ipConfigs) == 0 && cloudInit.User == nil && cloudInit.SSHKeys == nil &&
+		cloudInit.Nameserver == nil && cloudInit.SearchDomain == nil && cloudInit.Custom == nil {
+		return nil, nil
 	}
 
+	return &cloudInit, nil
+}
+
+// checkFirmware returns ErrEFIDiskRequiresOVMF when a VM with the bios would have an EFI disk without using OVMF
+func checkFirmware(bios *string, hasEFIDisk bool) error {
+	if hasEFIDisk && (bios == nil || *bios != "ovmf") {
+		return ErrEFIDiskRequiresOVMF
+	}
 	return nil
 }
+
+// intToBool converts the 0 or 1 Proxmox returns for boolean settings
+func intToBool(value *int64) *bool {
+	if value == nil {
+		return nil
+	}
+	converted := *value != 0
+	return &converted
+}
@@ -0,0 +1,53 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// CloneVM clones the VM or template and waits for the clone to finish, then reads the clone from the target node
+func (client *Client) CloneVM(ctx context.Context, node string, sourceID int64, options CloneOptions) (VirtualMachine, error) {
+	if options.NewID == 0 {
+		return VirtualMachine{}, fmt.Errorf("CloneVM-options: %w", errors.New("NewID is required"))
+	}
+
+	upid, err := do[UPID](ctx, client, "POST", NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(sourceID, 10)+"/clone", nil, options)
+	if err != nil {
+		return VirtualMachine{}, fmt.Errorf("CloneVM-request: %w", err)
+	}
+
+	// Copying the disks of full clones can take a long time
+	_, err = client.WaitForTask(ctx, upid, TaskWaitOptions{})
+	if err != nil {
+		return VirtualMachine{}, fmt.Errorf("CloneVM-wait-for-task: %w", err)
+	}
+
+	target := node
+	if options.Target != nil {
+		target = *options.Target
+	}
+
+	return client.GetVM(ctx, target, options.NewID)
+}
+
+// ConvertToTemplate turns the stopped VM into a template, which can be cloned but no longer started
+func (client *Client) ConvertToTemplate(ctx context.Context, node string, id int64) error {
+	upid, err := do[UPID](ctx, client, "POST", NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10)+"/template", nil, nil)
+	if err != nil {
+		return fmt.Errorf("ConvertToTemplate-request: %w", err)
+	}
+
+	// Older versions of Proxmox convert the VM without starting a task
+	if upid.IsZero() {
+		return nil
+	}
+
+	_, err = client.WaitForTask(ctx, upid, TaskWaitOptions{})
+	if err != nil {
+		return fmt.Errorf("ConvertToTemplate-wait-for-task: %w", err)
+	}
+
+	return nil
+}
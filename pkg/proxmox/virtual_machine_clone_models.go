@@ -0,0 +1,16 @@
+package proxmox
+
+// CloneOptions are the settings for CloneVM, NewID is required
+type CloneOptions struct {
+	NewID       int64   `json:"newid"`
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	// Full copies the disks instead of linking them to the disks of the template. Proxmox makes full clones of VMs
+	// and linked clones of templates by default.
+	Full    *bool   `json:"full,omitempty"`
+	Target  *string `json:"target,omitempty"`  // The node to create the clone on, by default the node of the source
+	Storage *string `json:"storage,omitempty"` // The storage for the disks, only for full clones
+	Pool    *string `json:"pool,omitempty"`    // The resource pool to add the clone to
+	// SnapshotName clones the VM as it was at the snapshot instead of its current state
+	SnapshotName *string `json:"snapname,omitempty"`
+}
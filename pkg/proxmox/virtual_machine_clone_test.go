@@ -0,0 +1,90 @@
+package proxmox
+
+import (
+	"context"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+	"github.com/clincha-org/proxmox-api/pkg/scsi"
+	"strings"
+	"testing"
+)
+
+func TestCloneVM(t *testing.T) {
+	client := newTestClient(t)
+
+	size := 8 * propstring.Gibibyte
+	name := "golden"
+	cores := int64(1)
+	memory := int64(512)
+	request := VirtualMachine{
+		ID:          102,
+		Name:        &name,
+		Cores:       &cores,
+		Memory:      &memory,
+		SCSIDevices: &[]scsi.Disk{{ID: 0, Storage: "local-lvm", Size: &size}},
+	}
+
+	_, err := client.CreateVM(context.Background(), "pve", &request, false)
+	t.Cleanup(func() {
+		for _, id := range []int64{104, 103, 102} {
+			err := client.DeleteVM(context.Background(), "pve", id)
+			if err != nil && !IsNotFound(err) {
+				t.Error(err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A full clone copies the disks of a VM
+	cloneName := "full-clone"
+	clone, err := client.CloneVM(context.Background(), "pve", 102, CloneOptions{NewID: 103, Name: &cloneName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clone.ID != 103 || *clone.Name != "full-clone" || clone.Template != nil {
+		t.Errorf("Expected VM 103 named full-clone, got %+v", clone)
+	}
+
+	if disk := (*clone.SCSIDevices)[0]; !strings.HasPrefix(*disk.Path, "vm-103-") || *disk.Size != size {
+		t.Errorf("Expected an 8G copy of scsi0 owned by VM 103, got %+v", disk)
+	}
+
+	err = client.ConvertToTemplate(context.Background(), "pve", 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := client.GetVM(context.Background(), "pve", 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if template.Template == nil || !*template.Template {
+		t.Fatalf("Expected VM 102 to be a template, got %+v", template.Template)
+	}
+
+	// Linked clones cannot move the disks to another storage
+	full := false
+	storage := "local-lvm"
+	_, err = client.CloneVM(context.Background(), "pve", 102, CloneOptions{NewID: 104, Full: &full, Storage: &storage})
+	if err == nil {
+		t.Error("Expected an error for a linked clone with a storage")
+	}
+
+	// A linked clone of a template shares its disks
+	linked, err := client.CloneVM(context.Background(), "pve", 102, CloneOptions{NewID: 104, Full: &full})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if disk := (*linked.SCSIDevices)[0]; !strings.HasPrefix(*disk.Path, "base-102-disk-0/vm-104-") {
+		t.Errorf("Expected scsi0 to be linked to the disk of the template, got %s", *disk.Path)
+	}
+
+	_, err = client.CloneVM(context.Background(), "pve", 102, CloneOptions{})
+	if err == nil {
+		t.Error("Expected an error for a clone without a new ID")
+	}
+}
@@ -1,35 +1,141 @@
 package proxmox
 
 import (
+	"encoding/json"
+	"github.com/clincha-org/proxmox-api/pkg/cloudinit"
+	"github.com/clincha-org/proxmox-api/pkg/efidisk"
 	"github.com/clincha-org/proxmox-api/pkg/ide"
+	"github.com/clincha-org/proxmox-api/pkg/netdev"
+	"github.com/clincha-org/proxmox-api/pkg/sata"
+	"github.com/clincha-org/proxmox-api/pkg/scsi"
+	"github.com/clincha-org/proxmox-api/pkg/tpmstate"
+	"github.com/clincha-org/proxmox-api/pkg/virtio"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 )
 
+// deviceSetting matches the settings of numbered devices, which are collected in the Devices maps
+var deviceSetting = regexp.MustCompile(`^(net|scsi|virtio|sata|ipconfig)\d+$`)
+
+// VirtualMachine is the configuration of a QEMU virtual machine.
+// Settings that are nil are not sent to Proxmox, and on read they are nil when Proxmox uses its default.
 type VirtualMachine struct {
-	ID           int64                      `json:"vmid"`
-	IDEDevices   *[]ide.InternalDataStorage `json:"-"`
-	SCSI1        *string                    `json:"net1"`
-	Net1         *string                    `json:"net1"`
-	SCSIHardware *string                    `json:"scsihw"`
-	Cores        int64                      `json:"cores"`
-	Memory       int64                      `json:"memory"`
+	ID          int64                      `json:"vmid"`
+	Name        *string                    `json:"name,omitempty"`
+	Description *string                    `json:"description,omitempty"`
+	Tags        *[]string                  `json:"tags,omitempty"`
+	IDEDevices  *[]ide.InternalDataStorage `json:"-"`
+	// NetworkDevices are net0 to net31. When updating, devices that are not in the list are removed.
+	NetworkDevices *[]netdev.NetworkDevice `json:"-"`
+	// SCSIDevices, VirtIODevices and SATADevices are the disks. When updating, disks that are not in the list are
+	// detached and kept as unused disks.
+	SCSIDevices   *[]scsi.Disk   `json:"-"`
+	VirtIODevices *[]virtio.Disk `json:"-"`
+	SATADevices   *[]sata.Disk   `json:"-"`
+	// EFIDisk is efidisk0, which requires BIOS to be ovmf. When updating, a Disk without a storage removes it.
+	EFIDisk *efidisk.Disk `json:"-"`
+	// TPMState is tpmstate0. When updating, a State without a storage removes it.
+	TPMState *tpmstate.State `json:"-"`
+	// CloudInit is nil when read from a VM without cloud-init settings or drive
+	CloudInit    *cloudinit.CloudInit `json:"-"`
+	SCSIHardware *string              `json:"scsihw,omitempty"`
+	Sockets      *int64               `json:"sockets,omitempty"`
+	Cores        *int64               `json:"cores,omitempty"`
+	VCPUs        *int64               `json:"vcpus,omitempty"`
+	CPU          *string              `json:"cpu,omitempty"` // CPU type, for example host or x86-64-v2-AES
+	CPULimit     *float64             `json:"cpulimit,omitempty"`
+	CPUUnits     *int64               `json:"cpuunits,omitempty"`
+	Numa         *bool                `json:"numa,omitempty"`
+	Memory       *int64               `json:"memory,omitempty"`
+	Balloon      *int64               `json:"balloon,omitempty"` // Minimum memory in MiB, 0 disables the balloon device
+	BIOS         *string              `json:"bios,omitempty"`    // seabios or ovmf
+	Machine      *string              `json:"machine,omitempty"`
+	OSType       *string              `json:"ostype,omitempty"`
+	Boot         *string              `json:"boot,omitempty"`  // Boot order, for example order=scsi0;ide2;net0
+	Agent        *string              `json:"agent,omitempty"` // QEMU guest agent, for example enabled=1,fstrim_cloned_disks=1
+	OnBoot       *bool                `json:"onboot,omitempty"`
+	Startup      *string              `json:"startup,omitempty"` // Startup and shutdown order, for example order=1,up=30
+	Protection   *bool                `json:"protection,omitempty"`
+	Hotplug      *string              `json:"hotplug,omitempty"` // Hotplug features, for example network,disk,usb
+	KVM          *bool                `json:"kvm,omitempty"`
+	ACPI         *bool                `json:"acpi,omitempty"`
+	Tablet       *bool                `json:"tablet,omitempty"`
+	LocalTime    *bool                `json:"localtime,omitempty"`
+	VGA          *string              `json:"vga,omitempty"`
+	// Template is set by Proxmox when the VM has been converted to a template, it is not sent on create or update
+	Template *bool `json:"template,omitempty"`
 }
 
+// VirtualMachineRequest is the request Proxmox expects when creating and updating VMs
 type VirtualMachineRequest struct {
-	ID           int64   `json:"vmid"`
-	IDE0         *string `json:"ide0,omitempty"`
-	IDE1         *string `json:"ide1,omitempty"`
-	IDE2         *string `json:"ide2,omitempty"`
-	IDE3         *string `json:"ide3,omitempty"`
-	SCSI1        *string `json:"scsi1,omitempty"`
-	Net1         *string `json:"net1,omitempty"`
-	SCSIHardware *string `json:"scsihw,omitempty"`
-	Cores        int64   `json:"cores,omitempty"`
-	Memory       int64   `json:"memory,omitempty"`
+	ID           int64    `json:"vmid"`
+	Name         *string  `json:"name,omitempty"`
+	Description  *string  `json:"description,omitempty"`
+	Tags         *string  `json:"tags,omitempty"` // Separated by semicolons
+	IDE0         *string  `json:"ide0,omitempty"`
+	IDE1         *string  `json:"ide1,omitempty"`
+	IDE2         *string  `json:"ide2,omitempty"`
+	IDE3         *string  `json:"ide3,omitempty"`
+	EFIDisk0     *string  `json:"efidisk0,omitempty"`
+	TPMState0    *string  `json:"tpmstate0,omitempty"`
+	CIUser       *string  `json:"ciuser,omitempty"`
+	CIPassword   *string  `json:"cipassword,omitempty"`
+	SSHKeys      *string  `json:"sshkeys,omitempty"` // Percent-encoded, see cloudinit.EncodeSSHKeys
+	Nameserver   *string  `json:"nameserver,omitempty"`
+	SearchDomain *string  `json:"searchdomain,omitempty"`
+	CICustom     *string  `json:"cicustom,omitempty"`
+	SCSIHardware *string  `json:"scsihw,omitempty"`
+	Sockets      *int64   `json:"sockets,omitempty"`
+	Cores        *int64   `json:"cores,omitempty"`
+	VCPUs        *int64   `json:"vcpus,omitempty"`
+	CPU          *string  `json:"cpu,omitempty"`
+	CPULimit     *float64 `json:"cpulimit,omitempty"`
+	CPUUnits     *int64   `json:"cpuunits,omitempty"`
+	Numa         *bool    `json:"numa,omitempty"`
+	Memory       *int64   `json:"memory,omitempty"`
+	Balloon      *int64   `json:"balloon,omitempty"`
+	BIOS         *string  `json:"bios,omitempty"`
+	Machine      *string  `json:"machine,omitempty"`
+	OSType       *string  `json:"ostype,omitempty"`
+	Boot         *string  `json:"boot,omitempty"`
+	Agent        *string  `json:"agent,omitempty"`
+	OnBoot       *bool    `json:"onboot,omitempty"`
+	Startup      *string  `json:"startup,omitempty"`
+	Protection   *bool    `json:"protection,omitempty"`
+	Hotplug      *string  `json:"hotplug,omitempty"`
+	KVM          *bool    `json:"kvm,omitempty"`
+	ACPI         *bool    `json:"acpi,omitempty"`
+	Tablet       *bool    `json:"tablet,omitempty"`
+	LocalTime    *bool    `json:"localtime,omitempty"`
+	VGA          *string  `json:"vga,omitempty"`
+	// Delete lists the settings to remove, separated by commas. Only used when updating.
+	Delete *string `json:"delete,omitempty"`
+	// Devices holds the numbered devices and IP configurations, such as net0 or ipconfig0, keyed by their setting
+	Devices map[string]string `json:"-"`
 }
 
-type VirtualMachinesResponse struct {
-	Data []VirtualMachineListItem `json:"data"`
+// MarshalJSON adds the numbered devices to the settings
+func (request VirtualMachineRequest) MarshalJSON() ([]byte, error) {
+	type settings VirtualMachineRequest
+	data, err := json.Marshal(settings(request))
+	if err != nil || len(request.Devices) == 0 {
+		return data, err
+	}
+
+	merged := map[string]any{}
+	err = json.Unmarshal(data, &merged)
+	if err != nil {
+		return nil, err
+	}
+	for setting, device := range request.Devices {
+		merged[setting] = device
+	}
+
+	return json.Marshal(merged)
 }
+
 type VirtualMachineListItem struct {
 	Status    string  `json:"status"`
 	Cpu       float32 `json:"cpu"`
@@ -47,9 +153,6 @@ type VirtualMachineListItem struct {
 	Cpus      int64   `json:"cpus"`
 }
 
-type VirtualMachineStatusResponse struct {
-	Data VirtualMachineStatus `json:"data"`
-}
 type VirtualMachineStatus struct {
 	Diskread       int64   `json:"diskread"`
 	Maxmem         int64   `json:"maxmem"`
@@ -65,33 +168,158 @@ type VirtualMachineStatus struct {
 	Diskwrite      int64   `json:"diskwrite"`
 	Cpu            float32 `json:"cpu"`
 	Name           string  `json:"name"`
-	Qmpstatus      string  `json:"qmpstatus"`
-	Pid            int64   `json:"pid"`
-	ID             int64   `json:"vmid"`
-	Netout         int64   `json:"netout"`
-	Uptime         int64   `json:"uptime"`
+	Qmpstatus      string  `json:"qmpstatus"` // paused while the VM is suspended to memory
+	// Lock is set while a task holds the configuration of the VM, and is suspended while the VM is hibernated
+	Lock   string `json:"lock"`
+	Pid    int64  `json:"pid"`
+	ID     int64  `json:"vmid"`
+	Netout int64  `json:"netout"`
+	Uptime int64  `json:"uptime"`
+}
+
+// PowerOptions controls whether the power actions, such as ShutdownVM, wait for the VM
+type PowerOptions struct {
+	// Wait waits for the task to finish and then for the VM to reach the state the action leads to
+	Wait bool
+	// WaitOptions controls how the task and the status of the VM are polled. The timeout covers both.
+	WaitOptions TaskWaitOptions
+}
+
+// ShutdownOptions are the settings for ShutdownVM
+type ShutdownOptions struct {
+	PowerOptions
+	// Timeout is how long Proxmox waits for the guest to shut down, it is rounded up to whole seconds
+	Timeout time.Duration
+	// ForceStop stops the VM when the guest has not shut down once the timeout has passed
+	ForceStop bool
+}
+
+// RebootOptions are the settings for RebootVM
+type RebootOptions struct {
+	PowerOptions
+	// Timeout is how long Proxmox waits for the guest to shut down, it is rounded up to whole seconds
+	Timeout time.Duration
 }
 
-type VirtualMachineConfigResponse struct {
-	Data VirtualMachineConfig `json:"data"`
+// SuspendOptions are the settings for SuspendVM
+type SuspendOptions struct {
+	PowerOptions
+	// ToDisk hibernates the VM, its memory is saved to StateStorage and the VM is stopped. Start or resume the VM to
+	// restore it.
+	ToDisk       bool
+	StateStorage *string
 }
+
+// VirtualMachineConfig is the configuration as /qemu/{id}/config returns it.
+// GetVM quotes every number before unmarshalling, so numbers are read from strings and booleans are 0 or 1.
 type VirtualMachineConfig struct {
-	Meta    string  `json:"meta"`
-	Boot    string  `json:"boot"`
-	Sockets int64   `json:"sockets,string"`
-	Cpu     string  `json:"cpu"`
-	IDE0    *string `json:"ide0,omitempty"`
-	IDE1    *string `json:"ide1,omitempty"`
-	IDE2    *string `json:"ide2,omitempty"`
-	IDE3    *string `json:"ide3,omitempty"`
-	Cores   int64   `json:"cores,string"`
-	Numa    int64   `json:"numa,string"`
-	Smbios1 string  `json:"smbios1"`
-	Vmgenid string  `json:"vmgenid"`
-	Net1    string  `json:"net1"`
-	Ostype  string  `json:"ostype"`
-	Scsi0   string  `json:"scsi0"`
-	Digest  string  `json:"digest"`
-	Scsihw  string  `json:"scsihw"`
-	Memory  int64   `json:"memory,string"`
+	Name         *string  `json:"name,omitempty"`
+	Description  *string  `json:"description,omitempty"`
+	Tags         *string  `json:"tags,omitempty"`
+	Meta         *string  `json:"meta,omitempty"`
+	Boot         *string  `json:"boot,omitempty"`
+	Sockets      *int64   `json:"sockets,string,omitempty"`
+	Cores        *int64   `json:"cores,string,omitempty"`
+	VCPUs        *int64   `json:"vcpus,string,omitempty"`
+	Cpu          *string  `json:"cpu,omitempty"`
+	CPULimit     *float64 `json:"cpulimit,string,omitempty"`
+	CPUUnits     *int64   `json:"cpuunits,string,omitempty"`
+	Numa         *int64   `json:"numa,string,omitempty"`
+	Memory       *int64   `json:"memory,string,omitempty"`
+	Balloon      *int64   `json:"balloon,string,omitempty"`
+	BIOS         *string  `json:"bios,omitempty"`
+	Machine      *string  `json:"machine,omitempty"`
+	Ostype       *string  `json:"ostype,omitempty"`
+	Agent        *string  `json:"agent,omitempty"`
+	OnBoot       *int64   `json:"onboot,string,omitempty"`
+	Startup      *string  `json:"startup,omitempty"`
+	Protection   *int64   `json:"protection,string,omitempty"`
+	Hotplug      *string  `json:"hotplug,omitempty"`
+	KVM          *int64   `json:"kvm,string,omitempty"`
+	ACPI         *int64   `json:"acpi,string,omitempty"`
+	Tablet       *int64   `json:"tablet,string,omitempty"`
+	LocalTime    *int64   `json:"localtime,string,omitempty"`
+	VGA          *string  `json:"vga,omitempty"`
+	Template     *int64   `json:"template,string,omitempty"`
+	IDE0         *string  `json:"ide0,omitempty"`
+	IDE1         *string  `json:"ide1,omitempty"`
+	IDE2         *string  `json:"ide2,omitempty"`
+	IDE3         *string  `json:"ide3,omitempty"`
+	EFIDisk0     *string  `json:"efidisk0,omitempty"`
+	TPMState0    *string  `json:"tpmstate0,omitempty"`
+	CIUser       *string  `json:"ciuser,omitempty"`
+	SSHKeys      *string  `json:"sshkeys,omitempty"`
+	Nameserver   *string  `json:"nameserver,omitempty"`
+	Searchdomain *string  `json:"searchdomain,omitempty"`
+	CICustom     *string  `json:"cicustom,omitempty"`
+	Smbios1      *string  `json:"smbios1,omitempty"`
+	Vmgenid      *string  `json:"vmgenid,omitempty"`
+	Scsihw       *string  `json:"scsihw,omitempty"`
+	Digest       string   `json:"digest"`
+	// Devices holds the numbered devices and IP configurations, such as net0 or ipconfig0, keyed by their setting
+	Devices map[string]string `json:"-"`
+}
+
+// UnmarshalJSON reads the settings and collects the numbered devices in Devices
+func (config *VirtualMachineConfig) UnmarshalJSON(data []byte) error {
+	type settings VirtualMachineConfig
+	err := json.Unmarshal(data, (*settings)(config))
+	if err != nil {
+		return err
+	}
+
+	all := map[string]any{}
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return err
+	}
+
+	config.Devices = map[string]string{}
+	for setting, value := range all {
+		device, ok := value.(string)
+		if ok && deviceSetting.MatchString(setting) {
+			config.Devices[setting] = device
+		}
+	}
+
+	return nil
+}
+
+// setting returns the value of an IDE setting or numbered device, or nil when it is not set
+func (config *VirtualMachineConfig) setting(name string) *string {
+	switch name {
+	case "ide0":
+		return config.IDE0
+	case "ide1":
+		return config.IDE1
+	case "ide2":
+		return config.IDE2
+	case "ide3":
+		return config.IDE3
+	}
+	value, ok := config.Devices[name]
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+// cloudInitDrive finds the cloud-init drive of the VM, it returns nil when the VM has none
+func (config *VirtualMachineConfig) cloudInitDrive() *cloudinit.Drive {
+	settings := []string{"ide0", "ide1", "ide2", "ide3"}
+	for setting := range config.Devices {
+		if cloudinit.DriveSetting.MatchString(setting) {
+			settings = append(settings, setting)
+		}
+	}
+	slices.Sort(settings)
+
+	for _, setting := range settings {
+		value := config.setting(setting)
+		if value != nil && cloudinit.IsDrive(*value) {
+			storage, _, _ := strings.Cut(*value, ":")
+			return &cloudinit.Drive{Setting: setting, Storage: storage}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,88 @@
+package proxmox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ListSnapshots returns the snapshots of the VM as a tree
+func (client *Client) ListSnapshots(ctx context.Context, node string, id int64) (SnapshotTree, error) {
+	items, err := do[[]snapshotListItem](ctx, client, "GET", snapshotPath(node, id), nil, nil)
+	if err != nil {
+		return SnapshotTree{}, fmt.Errorf("ListSnapshots-request: %w", err)
+	}
+
+	return newSnapshotTree(items), nil
+}
+
+// CreateSnapshot takes a snapshot of the VM and waits for it to finish
+func (client *Client) CreateSnapshot(ctx context.Context, node string, id int64, options SnapshotOptions) error {
+	if options.Name == "" {
+		return fmt.Errorf("CreateSnapshot-options: %w", errors.New("name is required"))
+	}
+
+	upid, err := do[UPID](ctx, client, "POST", snapshotPath(node, id), nil, options)
+	if err != nil {
+		return fmt.Errorf("CreateSnapshot-request: %w", err)
+	}
+
+	// Saving the memory of the VM can take a while
+	_, err = client.WaitForTask(ctx, upid, TaskWaitOptions{})
+	if err != nil {
+		return fmt.Errorf("CreateSnapshot-wait-for-task: %w", err)
+	}
+
+	return nil
+}
+
+// RollbackSnapshot returns the VM to the state of the snapshot and waits for the rollback to finish.
+// The VM is stopped afterwards, unless the memory was saved with the snapshot.
+func (client *Client) RollbackSnapshot(ctx context.Context, node string, id int64, name string) error {
+	upid, err := do[UPID](ctx, client, "POST", snapshotPath(node, id)+"/"+url.PathEscape(name)+"/rollback", nil, nil)
+	if err != nil {
+		return fmt.Errorf("RollbackSnapshot-request: %w", err)
+	}
+
+	_, err = client.WaitForTask(ctx, upid, TaskWaitOptions{})
+	if err != nil {
+		return fmt.Errorf("RollbackSnapshot-wait-for-task: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSnapshot removes the snapshot and waits for it to be removed. The children of the snapshot become children of
+// its parent.
+func (client *Client) DeleteSnapshot(ctx context.Context, node string, id int64, name string) error {
+	upid, err := do[UPID](ctx, client, "DELETE", snapshotPath(node, id)+"/"+url.PathEscape(name), nil, nil)
+	if err != nil {
+		return fmt.Errorf("DeleteSnapshot-request: %w", err)
+	}
+
+	_, err = client.WaitForTask(ctx, upid, TaskWaitOptions{})
+	if err != nil {
+		return fmt.Errorf("DeleteSnapshot-wait-for-task: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateSnapshotDescription changes the description of the snapshot, Proxmox does this without a task
+func (client *Client) UpdateSnapshotDescription(ctx context.Context, node string, id int64, name string, description string) error {
+	body := map[string]string{"description": description}
+
+	_, err := do[any](ctx, client, "PUT", snapshotPath(node, id)+"/"+url.PathEscape(name)+"/config", nil, body)
+	if err != nil {
+		return fmt.Errorf("UpdateSnapshotDescription-request: %w", err)
+	}
+
+	return nil
+}
+
+// snapshotPath returns the API path of the snapshots of the VM
+func snapshotPath(node string, id int64) string {
+	return NodesPath + "/" + node + VirtualMachinePath + "/" + strconv.FormatInt(id, 10) + "/snapshot"
+}
@@ -0,0 +1,133 @@
+package proxmox
+
+import (
+	"slices"
+	"time"
+)
+
+// CurrentSnapshotName is the name Proxmox lists the current state of the VM under, next to its snapshots
+const CurrentSnapshotName = "current"
+
+// Snapshot is a snapshot of a VM
+type Snapshot struct {
+	Name        string
+	Description string
+	// Parent is the snapshot that was current when this snapshot was taken, it is empty for the first snapshot
+	Parent string
+	Time   time.Time
+	// VMState reports whether the memory of the VM was saved, rolling back to the snapshot then resumes the VM
+	VMState bool
+}
+
+// SnapshotOptions are the settings for CreateSnapshot, Name is required
+type SnapshotOptions struct {
+	Name        string  `json:"snapname"`
+	Description *string `json:"description,omitempty"`
+	// VMState saves the memory of a running VM with the snapshot
+	VMState *bool `json:"vmstate,omitempty"`
+}
+
+// snapshotListItem is a snapshot as /qemu/{id}/snapshot lists it
+type snapshotListItem struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parent      string `json:"parent"`
+	SnapTime    int64  `json:"snaptime"`
+	VMState     int64  `json:"vmstate"`
+}
+
+// SnapshotTree holds the snapshots of a VM linked to their parents and children
+type SnapshotTree struct {
+	// Roots are the snapshots without a parent, ordered by the time they were taken
+	Roots []*SnapshotNode
+	// Current is the snapshot the current state of the VM is based on, it is nil when the VM has no snapshots
+	Current *SnapshotNode
+}
+
+// SnapshotNode is a snapshot in a SnapshotTree
+type SnapshotNode struct {
+	Snapshot
+	ParentNode *SnapshotNode // The node of Parent, nil for roots
+	Children   []*SnapshotNode
+}
+
+// newSnapshotTree links the snapshots to their parents, the current entry becomes SnapshotTree.Current
+func newSnapshotTree(items []snapshotListItem) SnapshotTree {
+	nodes := map[string]*SnapshotNode{}
+	var current string
+	for _, item := range items {
+		if item.Name == CurrentSnapshotName {
+			current = item.Parent
+			continue
+		}
+
+		snapshot := Snapshot{
+			Name:        item.Name,
+			Description: item.Description,
+			Parent:      item.Parent,
+			VMState:     item.VMState != 0,
+		}
+		if item.SnapTime != 0 {
+			snapshot.Time = time.Unix(item.SnapTime, 0)
+		}
+		nodes[item.Name] = &SnapshotNode{Snapshot: snapshot}
+	}
+
+	tree := SnapshotTree{Current: nodes[current]}
+	for _, node := range nodes {
+		parent, ok := nodes[node.Parent]
+		if !ok {
+			tree.Roots = append(tree.Roots, node)
+			continue
+		}
+		node.ParentNode = parent
+		parent.Children = append(parent.Children, node)
+	}
+
+	sortSnapshots(tree.Roots)
+	for _, node := range nodes {
+		sortSnapshots(node.Children)
+	}
+
+	return tree
+}
+
+// sortSnapshots orders the snapshots by the time they were taken, and by name when they were taken at the same time
+func sortSnapshots(snapshots []*SnapshotNode) {
+	slices.SortFunc(snapshots, func(a *SnapshotNode, b *SnapshotNode) int {
+		if compared := a.Time.Compare(b.Time); compared != 0 {
+			return compared
+		}
+		if a.Name < b.Name {
+			return -1
+		}
+		if a.Name > b.Name {
+			return 1
+		}
+		return 0
+	})
+}
+
+// Find returns the snapshot with the name, or nil when there is no such snapshot
+func (tree SnapshotTree) Find(name string) *SnapshotNode {
+	for _, snapshot := range tree.Snapshots() {
+		if snapshot.Name == name {
+			return snapshot
+		}
+	}
+	return nil
+}
+
+// Snapshots returns all snapshots, each parent before its children
+func (tree SnapshotTree) Snapshots() []*SnapshotNode {
+	var snapshots []*SnapshotNode
+	var walk func(nodes []*SnapshotNode)
+	walk = func(nodes []*SnapshotNode) {
+		for _, node := range nodes {
+			snapshots = append(snapshots, node)
+			walk(node.Children)
+		}
+	}
+	walk(tree.Roots)
+	return snapshots
+}
@@ -0,0 +1,146 @@
+package proxmox
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSnapshotTree(t *testing.T) {
+	tree := newSnapshotTree([]snapshotListItem{
+		{Name: "current", Description: "You are here!", Parent: "branch"},
+		{Name: "second", Parent: "first", SnapTime: 200, VMState: 1},
+		{Name: "first", Description: "Installed", SnapTime: 100},
+		{Name: "branch", Parent: "first", SnapTime: 150},
+	})
+
+	if len(tree.Roots) != 1 || tree.Roots[0].Name != "first" || tree.Roots[0].ParentNode != nil {
+		t.Fatalf("Expected first to be the only root, got %+v", tree.Roots)
+	}
+
+	children := tree.Roots[0].Children
+	if len(children) != 2 || children[0].Name != "branch" || children[1].Name != "second" {
+		t.Errorf("Expected branch and second to be children of first in the order they were taken, got %+v", children)
+	}
+
+	if tree.Current == nil || tree.Current.Name != "branch" || tree.Current.ParentNode.Name != "first" {
+		t.Errorf("Expected the VM to be based on branch, got %+v", tree.Current)
+	}
+
+	second := tree.Find("second")
+	if second == nil || !second.VMState || second.Time.Unix() != 200 {
+		t.Errorf("Expected second to include the VM state, got %+v", second)
+	}
+
+	if tree.Find("current") != nil {
+		t.Error("Expected the current state not to be listed as a snapshot")
+	}
+
+	if len(tree.Snapshots()) != 3 {
+		t.Errorf("Expected 3 snapshots, got %d", len(tree.Snapshots()))
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	client := newTestClient(t)
+
+	cores := int64(1)
+	memory := int64(512)
+	request := VirtualMachine{
+		ID:     102,
+		Cores:  &cores,
+		Memory: &memory,
+	}
+
+	_, err := client.CreateVM(context.Background(), "pve", &request, false)
+	t.Cleanup(func() {
+		for _, id := range []int64{103, 102} {
+			err := client.DeleteVM(context.Background(), "pve", id)
+			if err != nil && !IsNotFound(err) {
+				t.Error(err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	description := "Before the upgrade"
+	err = client.CreateSnapshot(context.Background(), "pve", 102, SnapshotOptions{Name: "first", Description: &description})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.StartVM(context.Background(), "pve", 102, PowerOptions{Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vmState := true
+	err = client.CreateSnapshot(context.Background(), "pve", 102, SnapshotOptions{Name: "second", VMState: &vmState})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.CreateSnapshot(context.Background(), "pve", 102, SnapshotOptions{Name: "second"})
+	if err == nil {
+		t.Error("Expected an error for a snapshot name that is already used")
+	}
+
+	err = client.RollbackSnapshot(context.Background(), "pve", 102, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := client.GetVMStatus(context.Background(), "pve", 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Status != "stopped" {
+		t.Errorf("Expected the VM to be stopped after rolling back to a snapshot without the VM state, got %s", status.Status)
+	}
+
+	err = client.UpdateSnapshotDescription(context.Background(), "pve", 102, "second", "Upgraded")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := client.ListSnapshots(context.Background(), "pve", 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tree.Current == nil || tree.Current.Name != "first" || tree.Current.Description != "Before the upgrade" {
+		t.Errorf("Expected the VM to be based on first, got %+v", tree.Current)
+	}
+
+	second := tree.Find("second")
+	if second == nil || second.ParentNode.Name != "first" || !second.VMState || second.Description != "Upgraded" {
+		t.Errorf("Expected second to be a child of first with the VM state, got %+v", second)
+	}
+
+	// Clones can be made from a snapshot
+	_, err = client.CloneVM(context.Background(), "pve", 102, CloneOptions{NewID: 103, SnapshotName: &second.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.DeleteSnapshot(context.Background(), "pve", 102, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = client.ListSnapshots(context.Background(), "pve", 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tree.Roots) != 1 || tree.Roots[0].Name != "second" || tree.Current != nil {
+		t.Errorf("Expected second to become the only root, got %+v", tree.Roots)
+	}
+
+	err = client.DeleteSnapshot(context.Background(), "pve", 102, "first")
+	if !IsNotFound(err) {
+		t.Errorf("Expected a not found error for a deleted snapshot, got %v", err)
+	}
+}
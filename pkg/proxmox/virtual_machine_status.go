@@ -1,127 +1,180 @@
 package proxmox
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"log/slog"
-	"net/http"
 	"strconv"
 )
 
-func (client *Client) GetVMStatus(node string, id int64) (VirtualMachineStatus, error) {
-	request, err := http.NewRequest(
-		"GET",
-		client.Host+ApiPath+NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10)+"/status/current",
-		nil,
-	)
+func (client *Client) GetVMStatus(ctx context.Context, node string, id int64) (VirtualMachineStatus, error) {
+	vmStatus, err := do[VirtualMachineStatus](ctx, client, "GET", NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10)+"/status/current", nil, nil)
 	if err != nil {
-		return VirtualMachineStatus{}, fmt.Errorf("GetVMStatus-build-request: %w", err)
+		return VirtualMachineStatus{}, fmt.Errorf("GetVMStatus-request: %w", err)
 	}
 
-	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
-	request.Header.Set("CSRFPreventionToken", client.Ticket.Data.CSRFPreventionToken)
-
-	response, err := client.HTTPClient.Do(request)
-	if err != nil {
-		return VirtualMachineStatus{}, fmt.Errorf("GetVMStatus-do-request: %w", err)
-	}
+	return vmStatus, nil
+}
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return VirtualMachineStatus{}, fmt.Errorf("GetVMStatus-read-response: %w", err)
-	}
+// StartVM starts the VM, or restores a hibernated VM
+func (client *Client) StartVM(ctx context.Context, node string, id int64, options PowerOptions) (UPID, error) {
+	return client.changeVMStatus(ctx, "StartVM", node, id, "start", nil, options, func(status VirtualMachineStatus) bool {
+		return status.Status == "running"
+	})
+}
 
-	err = response.Body.Close()
-	if err != nil {
-		return VirtualMachineStatus{}, fmt.Errorf("GetVMStatus-close-response: %w", err)
-	}
+// StartVm starts the VM and waits until it is running.
+//
+// Deprecated: Use StartVM, which returns the UPID of the task and only waits when asked to.
+func (client *Client) StartVm(ctx context.Context, node string, id int64) error {
+	_, err := client.StartVM(ctx, node, id, PowerOptions{Wait: true})
+	return err
+}
 
-	slog.Debug("api-response", "method", "GetVMStatus", "node", node, "status", response.Status, "response", string(body))
+// StopVM stops the VM immediately, like pulling the power cord. Use ShutdownVM to let the guest shut down cleanly.
+func (client *Client) StopVM(ctx context.Context, node string, id int64, options PowerOptions) (UPID, error) {
+	return client.changeVMStatus(ctx, "StopVM", node, id, "stop", nil, options, func(status VirtualMachineStatus) bool {
+		return status.Status == "stopped"
+	})
+}
 
-	if response.StatusCode != http.StatusOK {
-		return VirtualMachineStatus{}, fmt.Errorf("GetVMStatus-status-error: %s %s", response.Status, body)
+// ShutdownVM asks the guest to shut down through ACPI or the guest agent. With ForceStop the VM is stopped when the
+// guest has not shut down within the timeout.
+func (client *Client) ShutdownVM(ctx context.Context, node string, id int64, options ShutdownOptions) (UPID, error) {
+	body := map[string]any{}
+	if options.Timeout > 0 {
+		body["timeout"] = seconds(options.Timeout)
 	}
-
-	vmStatus := VirtualMachineStatusResponse{}
-	err = json.Unmarshal(body, &vmStatus)
-	if err != nil {
-		return VirtualMachineStatus{}, fmt.Errorf("GetVMStatus-unmarshal-response: %w", err)
+	if options.ForceStop {
+		body["forceStop"] = true
 	}
 
-	return vmStatus.Data, nil
+	return client.changeVMStatus(ctx, "ShutdownVM", node, id, "shutdown", body, options.PowerOptions, func(status VirtualMachineStatus) bool {
+		return status.Status == "stopped"
+	})
 }
 
-func (client *Client) StartVm(node string, id int64) error {
-	request, err := http.NewRequest(
-		"POST",
-		client.Host+ApiPath+NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10)+"/status/start",
-		nil,
-	)
-	if err != nil {
-		return fmt.Errorf("StartVM-build-request: %w", err)
+// RebootVM shuts the guest down cleanly and starts it again
+func (client *Client) RebootVM(ctx context.Context, node string, id int64, options RebootOptions) (UPID, error) {
+	body := map[string]any{}
+	if options.Timeout > 0 {
+		body["timeout"] = seconds(options.Timeout)
 	}
 
-	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
-	request.Header.Set("CSRFPreventionToken", client.Ticket.Data.CSRFPreventionToken)
+	return client.changeVMStatus(ctx, "RebootVM", node, id, "reboot", body, options.PowerOptions, func(status VirtualMachineStatus) bool {
+		return status.Status == "running"
+	})
+}
 
-	response, err := client.HTTPClient.Do(request)
-	if err != nil {
-		return fmt.Errorf("StartVM-do-request: %w", err)
-	}
+// ResetVM resets the VM immediately, like pressing the reset button, without shutting the guest down
+func (client *Client) ResetVM(ctx context.Context, node string, id int64, options PowerOptions) (UPID, error) {
+	return client.changeVMStatus(ctx, "ResetVM", node, id, "reset", nil, options, func(status VirtualMachineStatus) bool {
+		return status.Status == "running"
+	})
+}
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return fmt.Errorf("StartVM-read-response: %w", err)
+// SuspendVM pauses the VM in memory, or with ToDisk hibernates it and stops it
+func (client *Client) SuspendVM(ctx context.Context, node string, id int64, options SuspendOptions) (UPID, error) {
+	body := map[string]any{}
+	if options.ToDisk {
+		body["todisk"] = true
 	}
+	if options.StateStorage != nil {
+		body["statestorage"] = *options.StateStorage
+	}
+
+	return client.changeVMStatus(ctx, "SuspendVM", node, id, "suspend", body, options.PowerOptions, func(status VirtualMachineStatus) bool {
+		if options.ToDisk {
+			return status.Status == "stopped"
+		}
+		return status.Qmpstatus == "paused"
+	})
+}
 
-	err = response.Body.Close()
+// ResumeVM resumes a VM suspended in memory. A hibernated VM is started instead, which restores its memory.
+func (client *Client) ResumeVM(ctx context.Context, node string, id int64, options PowerOptions) (UPID, error) {
+	status, err := client.GetVMStatus(ctx, node, id)
 	if err != nil {
-		return fmt.Errorf("StartVM-close-response: %w", err)
+		return UPID{}, fmt.Errorf("ResumeVM-get-vm-status: %w", err)
 	}
 
-	slog.Debug("api-response", "method", "StartVM", "node", node, "status", response.Status, "response", string(body))
-
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("StartVM-status-error: %s %s", response.Status, body)
+	action := "resume"
+	if status.Status == "stopped" && status.Lock == "suspended" {
+		action = "start"
 	}
 
-	return nil
+	return client.changeVMStatus(ctx, "ResumeVM", node, id, action, nil, options, func(status VirtualMachineStatus) bool {
+		return status.Status == "running" && status.Qmpstatus != "paused"
+	})
 }
 
-func (client *Client) StopVM(node string, id int64) error {
-	request, err := http.NewRequest(
-		"POST",
-		client.Host+ApiPath+NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10)+"/status/stop",
-		nil,
-	)
+// changeVMStatus starts the status action and, when asked to, waits for the task and then for the VM to reach the
+// state. The errors are wrapped with the name of the method calling it.
+func (client *Client) changeVMStatus(ctx context.Context, method string, node string, id int64, action string, body map[string]any, options PowerOptions, reached func(VirtualMachineStatus) bool) (UPID, error) {
+	// A nil map would still be sent as null
+	var requestBody any
+	if len(body) > 0 {
+		requestBody = body
+	}
+
+	upid, err := do[UPID](ctx, client, "POST", NodesPath+"/"+node+VirtualMachinePath+"/"+strconv.FormatInt(id, 10)+"/status/"+action, nil, requestBody)
 	if err != nil {
-		return fmt.Errorf("StopVM-build-request: %w", err)
+		return UPID{}, fmt.Errorf("%s-request: %w", method, err)
 	}
 
-	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
-	request.Header.Set("CSRFPreventionToken", client.Ticket.Data.CSRFPreventionToken)
+	if !options.Wait {
+		return upid, nil
+	}
 
-	response, err := client.HTTPClient.Do(request)
-	if err != nil {
-		return fmt.Errorf("StopVM-do-request: %w", err)
+	waitOptions := options.WaitOptions
+	if waitOptions.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, waitOptions.Timeout)
+		defer cancel()
+		waitOptions.Timeout = 0
 	}
 
-	body, err := io.ReadAll(response.Body)
+	_, err = client.WaitForTask(ctx, upid, waitOptions)
 	if err != nil {
-		return fmt.Errorf("StopVM-read-response: %w", err)
+		return upid, fmt.Errorf("%s-wait-for-task: %w", method, err)
 	}
 
-	err = response.Body.Close()
+	err = client.waitForVMStatus(ctx, node, id, waitOptions, reached)
 	if err != nil {
-		return fmt.Errorf("StopVM-close-response: %w", err)
+		return upid, fmt.Errorf("%s-wait-for-status: %w", method, err)
 	}
 
-	slog.Debug("api-response", "method", "StopVM", "node", node, "status", response.Status, "response", string(body))
+	return upid, nil
+}
 
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("StopVM-status-error: %s %s", response.Status, body)
+// waitForVMStatus polls the status of the VM until it has reached the state, backing off like WaitForTask
+func (client *Client) waitForVMStatus(ctx context.Context, node string, id int64, options TaskWaitOptions, reached func(VirtualMachineStatus) bool) error {
+	interval := options.PollInterval
+	if interval <= 0 {
+		interval = DefaultTaskWaitOptions.PollInterval
+	}
+	maxInterval := options.MaxPollInterval
+	if maxInterval <= 0 {
+		maxInterval = DefaultTaskWaitOptions.MaxPollInterval
 	}
 
-	return nil
+	for {
+		status, err := client.GetVMStatus(ctx, node, id)
+		if err != nil {
+			return err
+		}
+
+		if reached(status) {
+			return nil
+		}
+
+		err = sleep(ctx, interval)
+		if err != nil {
+			return err
+		}
+
+		interval += interval / 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
 }
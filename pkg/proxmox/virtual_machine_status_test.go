@@ -0,0 +1,167 @@
+package proxmox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVMPowerActions(t *testing.T) {
+	client := newTestClient(t)
+
+	cores := int64(1)
+	memory := int64(512)
+	request := VirtualMachine{
+		ID:     102,
+		Cores:  &cores,
+		Memory: &memory,
+	}
+
+	_, err := client.CreateVM(context.Background(), "pve", &request, true)
+	t.Cleanup(func() {
+		err := client.DeleteVM(context.Background(), "pve", 102)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait := PowerOptions{Wait: true, WaitOptions: TaskWaitOptions{Timeout: time.Minute}}
+
+	expectStatus := func(status string, qmpStatus string) {
+		t.Helper()
+		vmStatus, err := client.GetVMStatus(context.Background(), "pve", 102)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vmStatus.Status != status || vmStatus.Qmpstatus != qmpStatus {
+			t.Errorf("Expected the VM to be %s (%s), got %s (%s)", status, qmpStatus, vmStatus.Status, vmStatus.Qmpstatus)
+		}
+	}
+
+	upid, err := client.SuspendVM(context.Background(), "pve", 102, SuspendOptions{PowerOptions: wait})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upid.Type != "qmsuspend" {
+		t.Errorf("Expected a qmsuspend task, got %s", upid.Type)
+	}
+	expectStatus("running", "paused")
+
+	// A paused VM cannot shut down unless it is forced to
+	_, err = client.ShutdownVM(context.Background(), "pve", 102, ShutdownOptions{})
+	if err == nil {
+		t.Error("Expected an error for shutting down a paused VM")
+	}
+
+	_, err = client.ResumeVM(context.Background(), "pve", 102, wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus("running", "running")
+
+	upid, err = client.RebootVM(context.Background(), "pve", 102, RebootOptions{PowerOptions: wait, Timeout: 30 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upid.Type != "qmreboot" {
+		t.Errorf("Expected a qmreboot task, got %s", upid.Type)
+	}
+
+	_, err = client.ResetVM(context.Background(), "pve", 102, wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus("running", "running")
+
+	// Hibernating stops the VM and resuming starts it again
+	_, err = client.SuspendVM(context.Background(), "pve", 102, SuspendOptions{PowerOptions: wait, ToDisk: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus("stopped", "stopped")
+
+	upid, err = client.ResumeVM(context.Background(), "pve", 102, wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upid.Type != "qmstart" {
+		t.Errorf("Expected a hibernated VM to be started, got a %s task", upid.Type)
+	}
+	expectStatus("running", "running")
+
+	_, err = client.ShutdownVM(context.Background(), "pve", 102, ShutdownOptions{PowerOptions: wait, Timeout: 30 * time.Second, ForceStop: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus("stopped", "stopped")
+
+	upid, err = client.StartVM(context.Background(), "pve", 102, wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upid.Type != "qmstart" {
+		t.Errorf("Expected a qmstart task, got %s", upid.Type)
+	}
+	expectStatus("running", "running")
+
+	upid, err = client.StopVM(context.Background(), "pve", 102, wait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upid.Type != "qmstop" {
+		t.Errorf("Expected a qmstop task, got %s", upid.Type)
+	}
+	expectStatus("stopped", "stopped")
+}
+
+func TestShutdownVMParameters(t *testing.T) {
+	server, client := newFakeClient(t)
+
+	var parameters map[string]any
+	server.OnRequest(func(request *http.Request, params map[string]any) {
+		if request.URL.Path == ApiPath+NodesPath+"/pve"+VirtualMachinePath+"/102/status/shutdown" {
+			parameters = params
+		}
+	})
+
+	cores := int64(1)
+	memory := int64(512)
+	_, err := client.CreateVM(context.Background(), "pve", &VirtualMachine{ID: 102, Cores: &cores, Memory: &memory}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without Wait the UPID is returned as soon as the task has started
+	upid, err := client.ShutdownVM(context.Background(), "pve", 102, ShutdownOptions{Timeout: 90 * time.Second, ForceStop: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if upid.Type != "qmshutdown" || upid.ID != "102" {
+		t.Errorf("Expected the UPID of the shutdown task, got %s", upid)
+	}
+
+	if parameters["timeout"] != json.Number("90") || parameters["forceStop"] != true {
+		t.Errorf("Expected a timeout of 90 seconds and forceStop, got %v", parameters)
+	}
+
+	_, err = client.StartVM(context.Background(), "pve", 102, PowerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Timeouts are rounded up, so a short timeout is not sent as 0
+	_, err = client.ShutdownVM(context.Background(), "pve", 102, ShutdownOptions{Timeout: 500 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parameters["timeout"] != json.Number("1") {
+		t.Errorf("Expected a timeout of 1 second, got %v", parameters["timeout"])
+	}
+}
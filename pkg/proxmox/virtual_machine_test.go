@@ -1,20 +1,27 @@
 package proxmox
 
 import (
+	"context"
+	"errors"
+	"github.com/clincha-org/proxmox-api/pkg/cloudinit"
+	"github.com/clincha-org/proxmox-api/pkg/efidisk"
 	"github.com/clincha-org/proxmox-api/pkg/ide"
-	"log/slog"
+	"github.com/clincha-org/proxmox-api/pkg/netdev"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+	"github.com/clincha-org/proxmox-api/pkg/sata"
+	"github.com/clincha-org/proxmox-api/pkg/scsi"
+	"github.com/clincha-org/proxmox-api/pkg/tpmstate"
+	"github.com/clincha-org/proxmox-api/pkg/virtio"
 	"testing"
+	"time"
 )
 
 const UbuntuTestIso = "ubuntu-24.04.1-live-server-amd64.iso"
 
 func TestGetVMs(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
-	_, err = client.GetVMs("pve")
+	_, err := client.GetVMs(context.Background(), "pve")
 
 	if err != nil {
 		t.Fatal(err)
@@ -22,10 +29,7 @@ func TestGetVMs(t *testing.T) {
 }
 
 func TestGetVM(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
 	isoPath := "iso/" + UbuntuTestIso
 	cdrom := ide.InternalDataStorage{
@@ -33,25 +37,28 @@ func TestGetVM(t *testing.T) {
 		Storage: "local",
 		Path:    &isoPath,
 	}
-	scsi1 := "local-lvm:8"
-	net1 := "model=virtio,bridge=vmbr0,firewall=1"
+	diskSize := 8 * propstring.Gibibyte
+	scsi1 := scsi.Disk{ID: 1, Storage: "local-lvm", Size: &diskSize}
+	bridge := "vmbr0"
+	firewall := true
+	net1 := netdev.NetworkDevice{ID: 1, Model: "virtio", Bridge: &bridge, Firewall: &firewall}
 	scsiHardware := "virtio-scsi-pci"
 	cores := int64(1)
 	memory := int64(2048)
 
 	request := VirtualMachine{
-		ID:           102,
-		IDEDevices:   &[]ide.InternalDataStorage{cdrom},
-		SCSI1:        &scsi1,
-		Net1:         &net1,
-		SCSIHardware: &scsiHardware,
-		Cores:        cores,
-		Memory:       memory,
+		ID:             102,
+		IDEDevices:     &[]ide.InternalDataStorage{cdrom},
+		SCSIDevices:    &[]scsi.Disk{scsi1},
+		NetworkDevices: &[]netdev.NetworkDevice{net1},
+		SCSIHardware:   &scsiHardware,
+		Cores:          &cores,
+		Memory:         &memory,
 	}
 
-	_, err = client.CreateVM("pve", &request, false)
+	_, err := client.CreateVM(context.Background(), "pve", &request, false)
 	t.Cleanup(func() {
-		err := client.DeleteVM("pve", 102)
+		err := client.DeleteVM(context.Background(), "pve", 102)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -61,27 +68,90 @@ func TestGetVM(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	vm, err := client.GetVM("pve", 102)
+	vm, err := client.GetVM(context.Background(), "pve", 102)
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if vm.Cores != 1 {
-		t.Errorf("Expected 1 core, got %d", vm.Cores)
+	if *vm.Cores != 1 {
+		t.Errorf("Expected 1 core, got %d", *vm.Cores)
 	}
 
-	if vm.Memory != 2048 {
-		t.Errorf("Expected 2048 memory, got %d", vm.Memory)
+	if *vm.Memory != 2048 {
+		t.Errorf("Expected 2048 memory, got %d", *vm.Memory)
 
 	}
 }
 
-func TestCreateVM(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
+// The cassettes hold the configuration of the same VM as Proxmox 7 and 8 return it.
+// Until they are recorded from real servers the synthetic fixtures, written by hand, are replayed instead, so the
+// differences between the versions are only checked once the recordings are in testdata.
+func TestGetVMRecorded(t *testing.T) {
+	for version, hostVariable := range map[string]string{"proxmox-7": "PROXMOX7_TEST_HOST", "proxmox-8": "PROXMOX8_TEST_HOST"} {
+		t.Run(version, func(t *testing.T) {
+			client := newCassetteClient(t, version+"/get-vm", hostVariable, createGetVMFixture)
+
+			vm, err := client.GetVM(context.Background(), "pve", 102)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *vm.Cores != 2 {
+				t.Errorf("Expected 2 cores, got %d", *vm.Cores)
+			}
+
+			if *vm.Memory != 2048 {
+				t.Errorf("Expected 2048 memory, got %d", *vm.Memory)
+			}
+
+			if len(*vm.NetworkDevices) != 1 || (*vm.NetworkDevices)[0].ID != 1 || *(*vm.NetworkDevices)[0].Bridge != "vmbr0" {
+				t.Errorf("Expected net1 on vmbr0, got %+v", *vm.NetworkDevices)
+			}
+
+			if len(*vm.SCSIDevices) != 1 || *(*vm.SCSIDevices)[0].Path != "vm-102-disk-0" || *(*vm.SCSIDevices)[0].Size != 8*propstring.Gibibyte {
+				t.Errorf("Expected the 8G disk on scsi1, got %+v", *vm.SCSIDevices)
+			}
+
+			if len(*vm.IDEDevices) != 1 || *(*vm.IDEDevices)[0].Media != "cdrom" {
+				t.Errorf("Expected the cdrom on ide2, got %+v", *vm.IDEDevices)
+			}
+		})
+	}
+}
+
+// createGetVMFixture creates the VM TestGetVMRecorded reads, before its cassette is recorded
+func createGetVMFixture(t *testing.T, client *Client) {
+	isoPath := "iso/" + UbuntuTestIso
+	media := "cdrom"
+	diskSize := 8 * propstring.Gibibyte
+	bridge := "vmbr0"
+	firewall := true
+	cores := int64(2)
+	memory := int64(2048)
+	request := VirtualMachine{
+		ID:             102,
+		IDEDevices:     &[]ide.InternalDataStorage{{ID: 2, Storage: "local", Path: &isoPath, Media: &media}},
+		SCSIDevices:    &[]scsi.Disk{{ID: 1, Storage: "local-lvm", Size: &diskSize}},
+		NetworkDevices: &[]netdev.NetworkDevice{{ID: 1, Model: "virtio", Bridge: &bridge, Firewall: &firewall}},
+		Cores:          &cores,
+		Memory:         &memory,
+	}
+
+	_, err := client.CreateVM(context.Background(), "pve", &request, false)
+	t.Cleanup(func() {
+		err := client.DeleteVM(context.Background(), "pve", 102)
+		if err != nil {
+			t.Error(err)
+		}
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
+}
+
+func TestCreateVM(t *testing.T) {
+	client := newTestClient(t)
 
 	isoPath := "iso/" + UbuntuTestIso
 	cdrom := ide.InternalDataStorage{
@@ -89,25 +159,28 @@ func TestCreateVM(t *testing.T) {
 		Storage: "local",
 		Path:    &isoPath,
 	}
-	scsi1 := "local-lvm:8"
-	net1 := "model=virtio,bridge=vmbr0,firewall=1"
+	diskSize := 8 * propstring.Gibibyte
+	scsi1 := scsi.Disk{ID: 1, Storage: "local-lvm", Size: &diskSize}
+	bridge := "vmbr0"
+	firewall := true
+	net1 := netdev.NetworkDevice{ID: 1, Model: "virtio", Bridge: &bridge, Firewall: &firewall}
 	scsiHardware := "virtio-scsi-pci"
 	cores := int64(1)
 	memory := int64(2048)
 
 	request := VirtualMachine{
-		ID:           102,
-		IDEDevices:   &[]ide.InternalDataStorage{cdrom},
-		SCSI1:        &scsi1,
-		Net1:         &net1,
-		SCSIHardware: &scsiHardware,
-		Cores:        cores,
-		Memory:       memory,
+		ID:             102,
+		IDEDevices:     &[]ide.InternalDataStorage{cdrom},
+		SCSIDevices:    &[]scsi.Disk{scsi1},
+		NetworkDevices: &[]netdev.NetworkDevice{net1},
+		SCSIHardware:   &scsiHardware,
+		Cores:          &cores,
+		Memory:         &memory,
 	}
 
-	vm, err := client.CreateVM("pve", &request, false)
+	vm, err := client.CreateVM(context.Background(), "pve", &request, false)
 	t.Cleanup(func() {
-		err := client.DeleteVM("pve", 102)
+		err := client.DeleteVM(context.Background(), "pve", 102)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -117,21 +190,18 @@ func TestCreateVM(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if vm.Cores != 1 {
-		t.Errorf("Expected 1 core, got %d", vm.Cores)
+	if *vm.Cores != 1 {
+		t.Errorf("Expected 1 core, got %d", *vm.Cores)
 	}
 
-	if vm.Memory != 2048 {
-		t.Errorf("Expected 2048 memory, got %d", vm.Memory)
+	if *vm.Memory != 2048 {
+		t.Errorf("Expected 2048 memory, got %d", *vm.Memory)
 	}
 
 }
 
 func TestCreateVMWithStart(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
 	isoPath := "iso/" + UbuntuTestIso
 	cdrom := ide.InternalDataStorage{
@@ -139,25 +209,28 @@ func TestCreateVMWithStart(t *testing.T) {
 		Storage: "local",
 		Path:    &isoPath,
 	}
-	scsi1 := "local-lvm:8"
-	net1 := "model=virtio,bridge=vmbr0,firewall=1"
+	diskSize := 8 * propstring.Gibibyte
+	scsi1 := scsi.Disk{ID: 1, Storage: "local-lvm", Size: &diskSize}
+	bridge := "vmbr0"
+	firewall := true
+	net1 := netdev.NetworkDevice{ID: 1, Model: "virtio", Bridge: &bridge, Firewall: &firewall}
 	scsiHardware := "virtio-scsi-pci"
 	cores := int64(1)
 	memory := int64(2048)
 
 	request := VirtualMachine{
-		ID:           102,
-		IDEDevices:   &[]ide.InternalDataStorage{cdrom},
-		SCSI1:        &scsi1,
-		Net1:         &net1,
-		SCSIHardware: &scsiHardware,
-		Cores:        cores,
-		Memory:       memory,
+		ID:             102,
+		IDEDevices:     &[]ide.InternalDataStorage{cdrom},
+		SCSIDevices:    &[]scsi.Disk{scsi1},
+		NetworkDevices: &[]netdev.NetworkDevice{net1},
+		SCSIHardware:   &scsiHardware,
+		Cores:          &cores,
+		Memory:         &memory,
 	}
 
-	vm, err := client.CreateVM("pve", &request, true)
+	vm, err := client.CreateVM(context.Background(), "pve", &request, true)
 	t.Cleanup(func() {
-		err := client.DeleteVM("pve", 102)
+		err := client.DeleteVM(context.Background(), "pve", 102)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -167,17 +240,14 @@ func TestCreateVMWithStart(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if vm.Cores != 1 {
-		t.Errorf("Expected 1 core, got %d", vm.Cores)
+	if *vm.Cores != 1 {
+		t.Errorf("Expected 1 core, got %d", *vm.Cores)
 	}
 
 }
 
 func TestUpdateVM(t *testing.T) {
-	client, err := NewClient(DefaultHostURL, TestUsername, TestPassword, slog.LevelDebug)
-	if err != nil {
-		t.Fatal(err)
-	}
+	client := newTestClient(t)
 
 	isoPath := "iso/" + UbuntuTestIso
 	cdrom := ide.InternalDataStorage{
@@ -191,22 +261,27 @@ func TestUpdateVM(t *testing.T) {
 		Storage: "local-lvm",
 		Size:    &newDiskSize,
 	}
-	scsi1 := "local-lvm:8"
-	net1 := "model=virtio,bridge=vmbr0,firewall=1"
+	diskSize := 8 * propstring.Gibibyte
+	scsi1 := scsi.Disk{ID: 1, Storage: "local-lvm", Size: &diskSize}
+	bridge := "vmbr0"
+	firewall := true
+	net1 := netdev.NetworkDevice{ID: 1, Model: "virtio", Bridge: &bridge, Firewall: &firewall}
 	scsiHardware := "virtio-scsi-pci"
+	cores := int64(1)
+	memory := int64(2048)
 	request := VirtualMachine{
-		ID:           102,
-		IDEDevices:   &[]ide.InternalDataStorage{cdrom, ide1},
-		SCSI1:        &scsi1,
-		Net1:         &net1,
-		SCSIHardware: &scsiHardware,
-		Cores:        1,
-		Memory:       2048,
+		ID:             102,
+		IDEDevices:     &[]ide.InternalDataStorage{cdrom, ide1},
+		SCSIDevices:    &[]scsi.Disk{scsi1},
+		NetworkDevices: &[]netdev.NetworkDevice{net1},
+		SCSIHardware:   &scsiHardware,
+		Cores:          &cores,
+		Memory:         &memory,
 	}
 
-	_, err = client.CreateVM("pve", &request, true)
+	_, err := client.CreateVM(context.Background(), "pve", &request, true)
 	t.Cleanup(func() {
-		err := client.DeleteVM("pve", 102)
+		err := client.DeleteVM(context.Background(), "pve", 102)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -215,24 +290,470 @@ func TestUpdateVM(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	request.Memory = 1024
-	request.Net1 = nil
-	request.SCSI1 = nil
+	newMemory := int64(1024)
+	request.Memory = &newMemory
+	request.NetworkDevices = nil
+	request.SCSIDevices = nil
 
-	vm, err := client.UpdateVM("pve", &request)
+	vm, err := client.UpdateVM(context.Background(), "pve", &request)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if vm.Cores != 1 {
-		t.Errorf("Expected 1 cores, got %d", vm.Cores)
+	if *vm.Cores != 1 {
+		t.Errorf("Expected 1 cores, got %d", *vm.Cores)
 	}
 
-	if vm.Memory != 1024 {
-		t.Errorf("Expected 1024 memory, got %d", vm.Memory)
+	if *vm.Memory != 1024 {
+		t.Errorf("Expected 1024 memory, got %d", *vm.Memory)
 	}
 
 	if len(*vm.IDEDevices) != 2 {
 		t.Errorf("Expected 2 ide devices, got %d", len(*vm.IDEDevices))
 	}
 }
+
+func TestVMConfigRoundTrip(t *testing.T) {
+	client := newTestClient(t)
+
+	name := "round-trip"
+	description := "Created by the tests"
+	tags := []string{"test", "proxmox-api"}
+	sockets := int64(2)
+	cpu := "x86-64-v2-AES"
+	numa := true
+	balloon := int64(512)
+	bios := "seabios"
+	ostype := "l26"
+	boot := "order=scsi1;net1"
+	agent := "enabled=1"
+	onboot := false
+	protection := false
+	startup := "order=2,up=30"
+
+	cores := int64(2)
+	memory := int64(1024)
+	request := VirtualMachine{
+		ID:          102,
+		Name:        &name,
+		Description: &description,
+		Tags:        &tags,
+		Sockets:     &sockets,
+		Cores:       &cores,
+		CPU:         &cpu,
+		Numa:        &numa,
+		Memory:      &memory,
+		Balloon:     &balloon,
+		BIOS:        &bios,
+		OSType:      &ostype,
+		Boot:        &boot,
+		Agent:       &agent,
+		OnBoot:      &onboot,
+		Protection:  &protection,
+		Startup:     &startup,
+	}
+
+	vm, err := client.CreateVM(context.Background(), "pve", &request, false)
+	t.Cleanup(func() {
+		err := client.DeleteVM(context.Background(), "pve", 102)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *vm.Name != name || *vm.Description != description || *vm.CPU != cpu || *vm.Agent != agent || *vm.Startup != startup {
+		t.Errorf("Expected the string settings to be returned unchanged, got %+v", vm)
+	}
+
+	if len(*vm.Tags) != 2 || (*vm.Tags)[0] != "test" || (*vm.Tags)[1] != "proxmox-api" {
+		t.Errorf("Expected tags %v, got %v", tags, *vm.Tags)
+	}
+
+	if *vm.Sockets != 2 || *vm.Cores != 2 || *vm.Memory != 1024 || *vm.Balloon != 512 {
+		t.Errorf("Expected the number settings to be returned unchanged, got %+v", vm)
+	}
+
+	if !*vm.Numa || *vm.OnBoot || *vm.Protection {
+		t.Errorf("Expected numa to be enabled and onboot and protection disabled, got %v %v %v", *vm.Numa, *vm.OnBoot, *vm.Protection)
+	}
+
+	if vm.Machine != nil || vm.Hotplug != nil {
+		t.Errorf("Expected settings that were not set to be nil, got %v %v", vm.Machine, vm.Hotplug)
+	}
+
+	// Only the settings that are set are changed, an empty string removes the setting
+	description = ""
+	protection = true
+	moreCores := int64(4)
+	update := VirtualMachine{
+		ID:          102,
+		Description: &description,
+		Protection:  &protection,
+		Cores:       &moreCores,
+	}
+
+	vm, err = client.UpdateVM(context.Background(), "pve", &update)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vm.Description != nil {
+		t.Errorf("Expected the description to be removed, got %q", *vm.Description)
+	}
+
+	if !*vm.Protection || *vm.Cores != 4 {
+		t.Errorf("Expected protection and 4 cores, got %v and %d", *vm.Protection, *vm.Cores)
+	}
+
+	if *vm.Name != name || *vm.Memory != 1024 {
+		t.Errorf("Expected the settings that were not set to be kept, got %q and %d", *vm.Name, *vm.Memory)
+	}
+
+	// Protected VMs cannot be removed
+	protection = false
+	_, err = client.UpdateVM(context.Background(), "pve", &VirtualMachine{ID: 102, Protection: &protection})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVMNetworkDevices(t *testing.T) {
+	client := newTestClient(t)
+
+	bridge := "vmbr0"
+	firewall := true
+	tag := int64(10)
+	queues := int64(2)
+	cores := int64(1)
+	memory := int64(512)
+	request := VirtualMachine{
+		ID:     102,
+		Cores:  &cores,
+		Memory: &memory,
+		NetworkDevices: &[]netdev.NetworkDevice{
+			{ID: 0, Model: "virtio", Bridge: &bridge, Firewall: &firewall, Queues: &queues},
+			{ID: 1, Model: "e1000", Bridge: &bridge, Tag: &tag},
+		},
+	}
+
+	vm, err := client.CreateVM(context.Background(), "pve", &request, false)
+	t.Cleanup(func() {
+		err := client.DeleteVM(context.Background(), "pve", 102)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices := *vm.NetworkDevices
+	if len(devices) != 2 {
+		t.Fatalf("Expected 2 network devices, got %d", len(devices))
+	}
+
+	if devices[0].Model != "virtio" || devices[0].MAC == nil || !*devices[0].Firewall || *devices[0].Queues != 2 {
+		t.Errorf("Expected net0 to be a virtio device with a generated MAC address, got %+v", devices[0])
+	}
+
+	if devices[1].Model != "e1000" || *devices[1].Tag != 10 {
+		t.Errorf("Expected net1 to be an e1000 device with VLAN tag 10, got %+v", devices[1])
+	}
+
+	// Devices that are left out of the list are removed
+	mac := *devices[0].MAC
+	tag = 20
+	devices[0].Tag = &tag
+
+	vm, err = client.UpdateVM(context.Background(), "pve", &VirtualMachine{ID: 102, NetworkDevices: &[]netdev.NetworkDevice{devices[0]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devices = *vm.NetworkDevices
+	if len(devices) != 1 {
+		t.Fatalf("Expected net1 to be removed, got %d devices", len(devices))
+	}
+
+	if *devices[0].MAC != mac || *devices[0].Tag != 20 {
+		t.Errorf("Expected net0 to keep its MAC address %s and have VLAN tag 20, got %+v", mac, devices[0])
+	}
+}
+
+func TestVMDisks(t *testing.T) {
+	client := newTestClient(t)
+
+	size := 8 * propstring.Gibibyte
+	smallSize := 2 * propstring.Gibibyte
+	enabled := true
+	cache := "writeback"
+	scsiHardware := "virtio-scsi-single"
+	cores := int64(1)
+	memory := int64(512)
+	request := VirtualMachine{
+		ID:            102,
+		Cores:         &cores,
+		Memory:        &memory,
+		SCSIHardware:  &scsiHardware,
+		SCSIDevices:   &[]scsi.Disk{{ID: 0, Storage: "local-lvm", Size: &size, IOThread: &enabled, Discard: &enabled}},
+		VirtIODevices: &[]virtio.Disk{{ID: 1, Storage: "local-lvm", Size: &smallSize, Cache: &cache}},
+		SATADevices:   &[]sata.Disk{{ID: 2, Storage: "local-lvm", Size: &smallSize, SSD: &enabled}},
+	}
+
+	vm, err := client.CreateVM(context.Background(), "pve", &request, false)
+	t.Cleanup(func() {
+		err := client.DeleteVM(context.Background(), "pve", 102)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scsiDisk := (*vm.SCSIDevices)[0]
+	if scsiDisk.Storage != "local-lvm" || scsiDisk.Path == nil || *scsiDisk.Size != size || !*scsiDisk.IOThread || !*scsiDisk.Discard {
+		t.Errorf("Expected an allocated 8G scsi0 with an IO thread and discard, got %+v", scsiDisk)
+	}
+
+	virtioDisk := (*vm.VirtIODevices)[0]
+	if virtioDisk.ID != 1 || *virtioDisk.Size != smallSize || *virtioDisk.Cache != "writeback" {
+		t.Errorf("Expected a 2G virtio1 with writeback cache, got %+v", virtioDisk)
+	}
+
+	sataDisk := (*vm.SATADevices)[0]
+	if sataDisk.ID != 2 || !*sataDisk.SSD {
+		t.Errorf("Expected sata2 on an SSD, got %+v", sataDisk)
+	}
+
+	// Disks that are left out of the list are detached
+	vm, err = client.UpdateVM(context.Background(), "pve", &VirtualMachine{ID: 102, SATADevices: &[]sata.Disk{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*vm.SATADevices) != 0 {
+		t.Errorf("Expected sata2 to be detached, got %+v", *vm.SATADevices)
+	}
+
+	if len(*vm.SCSIDevices) != 1 || len(*vm.VirtIODevices) != 1 {
+		t.Errorf("Expected the other disks to be kept, got %+v and %+v", *vm.SCSIDevices, *vm.VirtIODevices)
+	}
+}
+
+func TestSetDevicesUnchanged(t *testing.T) {
+	// Proxmox writes unknown options such as snapshot between the known ones, not after them
+	path := "vm-102-disk-0"
+	size := 8 * propstring.Gibibyte
+	data, err := scsi.Marshal(&scsi.Disk{ID: 0, Storage: "local-lvm", Path: &path, Size: &size, Extra: map[string]string{"snapshot": "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := VirtualMachineRequest{}
+	request.setDevices("scsi", map[string]string{"scsi0": data}, map[string]string{"scsi0": "local-lvm:vm-102-disk-0,snapshot=1,size=8G"})
+
+	if len(request.Devices) != 0 {
+		t.Errorf("Expected the unchanged disk to be left out, got %v", request.Devices)
+	}
+}
+
+func TestVMFirmware(t *testing.T) {
+	client := newTestClient(t)
+
+	ovmf := "ovmf"
+	efiType := "4m"
+	version := "v2.0"
+	enabled := true
+	cores := int64(1)
+	memory := int64(512)
+	request := VirtualMachine{
+		ID:       102,
+		Cores:    &cores,
+		Memory:   &memory,
+		EFIDisk:  &efidisk.Disk{Storage: "local-lvm", EFIType: &efiType, PreEnrolledKeys: &enabled},
+		TPMState: &tpmstate.State{Storage: "local-lvm", Version: &version},
+	}
+
+	// The EFI disk is rejected before anything is sent without the ovmf bios
+	_, err := client.CreateVM(context.Background(), "pve", &request, false)
+	if !errors.Is(err, ErrEFIDiskRequiresOVMF) {
+		t.Fatalf("Expected ErrEFIDiskRequiresOVMF, got %v", err)
+	}
+
+	request.BIOS = &ovmf
+	vm, err := client.CreateVM(context.Background(), "pve", &request, false)
+	t.Cleanup(func() {
+		err := client.DeleteVM(context.Background(), "pve", 102)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vm.EFIDisk == nil || vm.EFIDisk.Path == nil || *vm.EFIDisk.EFIType != "4m" || !*vm.EFIDisk.PreEnrolledKeys {
+		t.Errorf("Expected an allocated 4m EFI disk with pre-enrolled keys, got %+v", vm.EFIDisk)
+	}
+
+	if vm.TPMState == nil || vm.TPMState.Path == nil || *vm.TPMState.Version != "v2.0" {
+		t.Errorf("Expected an allocated v2.0 TPM state, got %+v", vm.TPMState)
+	}
+
+	// Switching back to SeaBIOS is rejected while the EFI disk is kept
+	seabios := "seabios"
+	_, err = client.UpdateVM(context.Background(), "pve", &VirtualMachine{ID: 102, BIOS: &seabios})
+	if !errors.Is(err, ErrEFIDiskRequiresOVMF) {
+		t.Fatalf("Expected ErrEFIDiskRequiresOVMF, got %v", err)
+	}
+
+	vm, err = client.UpdateVM(context.Background(), "pve", &VirtualMachine{ID: 102, BIOS: &seabios, EFIDisk: &efidisk.Disk{}, TPMState: &tpmstate.State{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vm.EFIDisk != nil || vm.TPMState != nil || *vm.BIOS != "seabios" {
+		t.Errorf("Expected the EFI disk and TPM state to be removed, got %+v and %+v", vm.EFIDisk, vm.TPMState)
+	}
+}
+
+func TestVMCloudInit(t *testing.T) {
+	client := newTestClient(t)
+
+	user := "ubuntu"
+	password := "secret"
+	nameserver := "1.1.1.1 8.8.8.8"
+	searchDomain := "example.com"
+	dhcp := cloudinit.DHCP
+	bridge := "vmbr0"
+	keys := []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIB+/x= user@host"}
+	cores := int64(1)
+	memory := int64(512)
+	request := VirtualMachine{
+		ID:             102,
+		Cores:          &cores,
+		Memory:         &memory,
+		NetworkDevices: &[]netdev.NetworkDevice{{ID: 0, Model: "virtio", Bridge: &bridge}},
+		CloudInit: &cloudinit.CloudInit{
+			User:         &user,
+			Password:     &password,
+			SSHKeys:      &keys,
+			Nameserver:   &nameserver,
+			SearchDomain: &searchDomain,
+			IPConfigs:    &[]cloudinit.IPConfig{{ID: 0, IP: &dhcp}},
+			Drive:        &cloudinit.Drive{Setting: "ide2", Storage: "local-lvm"},
+		},
+	}
+
+	vm, err := client.CreateVM(context.Background(), "pve", &request, false)
+	t.Cleanup(func() {
+		err := client.DeleteVM(context.Background(), "pve", 102)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloudInit := vm.CloudInit
+	if cloudInit == nil || *cloudInit.User != "ubuntu" || *cloudInit.Nameserver != nameserver || *cloudInit.SearchDomain != searchDomain {
+		t.Fatalf("Expected the cloud-init settings to be set, got %+v", cloudInit)
+	}
+
+	if cloudInit.Password != nil {
+		t.Errorf("Expected the password not to be returned, got %q", *cloudInit.Password)
+	}
+
+	if len(*cloudInit.SSHKeys) != 1 || (*cloudInit.SSHKeys)[0] != keys[0] {
+		t.Errorf("Expected the SSH keys %q, got %q", keys, *cloudInit.SSHKeys)
+	}
+
+	if len(*cloudInit.IPConfigs) != 1 || *(*cloudInit.IPConfigs)[0].IP != cloudinit.DHCP {
+		t.Errorf("Expected ipconfig0 to use DHCP, got %+v", *cloudInit.IPConfigs)
+	}
+
+	if cloudInit.Drive == nil || *cloudInit.Drive != (cloudinit.Drive{Setting: "ide2", Storage: "local-lvm"}) {
+		t.Errorf("Expected the cloud-init drive on ide2, got %+v", cloudInit.Drive)
+	}
+
+	if len(*vm.IDEDevices) != 0 {
+		t.Errorf("Expected the cloud-init drive to be left out of the IDE devices, got %+v", *vm.IDEDevices)
+	}
+
+	err = client.RegenerateCloudInit(context.Background(), "pve", 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The drive cannot replace another device
+	_, err = client.UpdateVM(context.Background(), "pve", &VirtualMachine{ID: 102, CloudInit: &cloudinit.CloudInit{Drive: &cloudinit.Drive{Setting: "net0", Storage: "local-lvm"}}})
+	if err == nil {
+		t.Error("Expected an error for a cloud-init drive on net0")
+	}
+
+	address := "192.168.1.10/24"
+	gateway := "192.168.1.1"
+	empty := ""
+	vm, err = client.UpdateVM(context.Background(), "pve", &VirtualMachine{
+		ID: 102,
+		CloudInit: &cloudinit.CloudInit{
+			SSHKeys:    &[]string{},
+			Nameserver: &empty,
+			IPConfigs:  &[]cloudinit.IPConfig{{ID: 0, IP: &address, Gateway: &gateway}},
+			Drive:      &cloudinit.Drive{Setting: "scsi1", Storage: "local-lvm"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloudInit = vm.CloudInit
+	if cloudInit.SSHKeys != nil || cloudInit.Nameserver != nil || *cloudInit.User != "ubuntu" {
+		t.Errorf("Expected the SSH keys and nameserver to be removed and the user to be kept, got %+v", cloudInit)
+	}
+
+	if ipConfig := (*cloudInit.IPConfigs)[0]; *ipConfig.IP != address || *ipConfig.Gateway != gateway {
+		t.Errorf("Expected a static address on ipconfig0, got %+v", ipConfig)
+	}
+
+	if cloudInit.Drive == nil || cloudInit.Drive.Setting != "scsi1" || len(*vm.SCSIDevices) != 0 {
+		t.Errorf("Expected the cloud-init drive to move to scsi1, got %+v and %+v", cloudInit.Drive, *vm.SCSIDevices)
+	}
+
+	// The drive is kept when the disks are replaced
+	vm, err = client.UpdateVM(context.Background(), "pve", &VirtualMachine{ID: 102, SCSIDevices: &[]scsi.Disk{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vm.CloudInit.Drive == nil {
+		t.Error("Expected the cloud-init drive to be kept")
+	}
+}
+
+func TestCreateVMCancelledWhileWaiting(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.HangTasks("qmcreate")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	cores := int64(1)
+	memory := int64(2048)
+	request := VirtualMachine{
+		ID:         102,
+		IDEDevices: &[]ide.InternalDataStorage{},
+		Cores:      &cores,
+		Memory:     &memory,
+	}
+
+	_, err := client.CreateVM(ctx, "pve", &request, false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to abort CreateVM, got %v", err)
+	}
+}
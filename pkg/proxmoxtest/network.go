@@ -0,0 +1,158 @@
+package proxmoxtest
+
+import (
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// integerNetworkKeys are the options Proxmox returns as numbers, everything else is returned as a string
+var integerNetworkKeys = []string{"autostart", "bridge_vlan_aware", "active", "exists"}
+
+func (server *Server) handleNetwork(request *request) (any, error) {
+	path := request.path[1:]
+
+	if len(path) == 0 {
+		switch request.method {
+		case "GET":
+			return listNetworks(request), nil
+		case "POST":
+			return nil, createNetwork(request)
+		case "PUT":
+			return server.reloadNetwork(request), nil
+		case "DELETE":
+			return nil, nil
+		}
+		return nil, notImplemented(request.method, request.path)
+	}
+
+	network, ok := request.node.networks[path[0]]
+	if !ok {
+		return nil, newError(http.StatusInternalServerError, "interface does not exist")
+	}
+
+	switch request.method {
+	case "GET":
+		return maps.Clone(network), nil
+	case "PUT":
+		return nil, updateNetwork(network, request.params)
+	case "DELETE":
+		delete(request.node.networks, path[0])
+		return nil, nil
+	}
+
+	return nil, notImplemented(request.method, request.path)
+}
+
+func listNetworks(request *request) []map[string]any {
+	networkType, _ := stringParam(request.params, "type")
+
+	names := make([]string, 0, len(request.node.networks))
+	for name := range request.node.networks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	networks := []map[string]any{}
+	for _, name := range names {
+		network := request.node.networks[name]
+		if networkType != "" && network["type"] != networkType {
+			continue
+		}
+		networks = append(networks, maps.Clone(network))
+	}
+	return networks
+}
+
+func createNetwork(request *request) error {
+	name, _ := stringParam(request.params, "iface")
+	if name == "" {
+		return &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"iface": "property is missing and it is not optional"}}
+	}
+	if _, exists := request.node.networks[name]; exists {
+		return &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"iface": "interface already exists"}}
+	}
+
+	network := map[string]any{
+		"iface":    name,
+		"families": []string{"inet"},
+		"method":   "manual",
+	}
+
+	err := updateNetwork(network, request.params)
+	if err != nil {
+		return err
+	}
+
+	request.node.networks[name] = network
+	return nil
+}
+
+// updateNetwork applies the parameters to the interface. Options that are not given are kept, empty options are removed.
+func updateNetwork(network map[string]any, params map[string]any) error {
+	params = maps.Clone(params)
+	delete(params, "iface")
+
+	deleted, _ := stringParam(params, "delete")
+	delete(params, "delete")
+	for _, key := range strings.Split(deleted, ",") {
+		delete(network, strings.TrimSpace(key))
+	}
+
+	if cidr, ok := stringParam(params, "cidr"); ok && cidr != "" {
+		address, prefix, found := strings.Cut(cidr, "/")
+		if !found {
+			return &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"cidr": "value does not look like a valid CIDR network"}}
+		}
+		params["address"] = address
+		params["netmask"] = prefix
+		delete(params, "cidr")
+	}
+
+	if netmask, ok := stringParam(params, "netmask"); ok && strings.Contains(netmask, ".") {
+		ip := net.ParseIP(netmask).To4()
+		if ip == nil {
+			return &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"netmask": "value does not look like a valid netmask"}}
+		}
+		prefix, _ := net.IPMask(ip).Size()
+		params["netmask"] = strconv.Itoa(prefix)
+	}
+
+	for key := range params {
+		value, _ := stringParam(params, key)
+		switch {
+		case value == "":
+			delete(network, key)
+		case slices.Contains(integerNetworkKeys, key):
+			number, _ := strconv.ParseInt(value, 10, 64)
+			network[key] = number
+		case key == "comments":
+			// Proxmox keeps the comments in /etc/network/interfaces and returns them with a trailing newline
+			network[key] = value + "\n"
+		default:
+			network[key] = value
+		}
+	}
+
+	address, hasAddress := network["address"].(string)
+	netmask, hasNetmask := network["netmask"].(string)
+	if hasAddress && hasNetmask {
+		network["cidr"] = address + "/" + netmask
+		network["method"] = "static"
+	} else {
+		delete(network, "cidr")
+	}
+
+	return nil
+}
+
+// reloadNetwork applies the configuration the way ifupdown2 does, in a task
+func (server *Server) reloadNetwork(request *request) string {
+	for _, network := range request.node.networks {
+		network["active"] = int64(1)
+	}
+	return server.newTask(request, "srvreload", "networking")
+}
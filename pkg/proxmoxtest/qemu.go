@@ -0,0 +1,598 @@
+package proxmoxtest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type vm struct {
+	id        int64
+	status    string
+	config    map[string]any
+	disks     int
+	snapshots map[string]*snapshot
+	// paused is set while a running VM is suspended to memory
+	paused bool
+}
+
+// diskKey matches the configuration keys of disks, where STORAGE:SIZE allocates a new volume
+var diskKey = regexp.MustCompile(`^(ide\d|sata\d|scsi\d+|virtio\d+|efidisk0|tpmstate0)$`)
+
+// netKey matches the configuration keys of network devices
+var netKey = regexp.MustCompile(`^net\d+$`)
+
+var networkModels = []string{
+	"e1000", "e1000-82540em", "e1000-82544gc", "e1000-82545em", "e1000e", "i82551", "i82557b", "i82559er",
+	"ne2k_isa", "ne2k_pci", "pcnet", "rtl8139", "virtio", "vmxnet3",
+}
+
+// VMConfig returns a copy of the configuration of a virtual machine as the API returns it
+func (server *Server) VMConfig(node string, id int64) (map[string]any, bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	n, ok := server.nodes[node]
+	if !ok {
+		return nil, false
+	}
+	vm, ok := n.vms[id]
+	if !ok {
+		return nil, false
+	}
+	return maps.Clone(vm.config), true
+}
+
+// VMStatus returns the status of a virtual machine, either running or stopped
+func (server *Server) VMStatus(node string, id int64) (string, bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	n, ok := server.nodes[node]
+	if !ok {
+		return "", false
+	}
+	vm, ok := n.vms[id]
+	if !ok {
+		return "", false
+	}
+	return vm.status, true
+}
+
+func (server *Server) handleQemu(request *request) (any, error) {
+	path := request.path[1:]
+
+	if len(path) == 0 {
+		switch request.method {
+		case "GET":
+			return server.listVMs(request.node), nil
+		case "POST":
+			return server.createVM(request)
+		}
+		return nil, notImplemented(request.method, request.path)
+	}
+
+	id, err := parseID(path[0])
+	if err != nil {
+		return nil, err
+	}
+
+	vm, ok := request.node.vms[id]
+	if !ok {
+		return nil, newError(http.StatusInternalServerError, "Configuration file 'nodes/%s/qemu-server/%d.conf' does not exist", request.node.name, id)
+	}
+
+	action := strings.Join(path[1:], "/")
+	switch {
+	case action == "" && request.method == "DELETE":
+		return server.deleteVM(request, vm)
+	case action == "config" && request.method == "GET":
+		return configResponse(vm), nil
+	case action == "config" && request.method == "PUT":
+		err = server.updateConfig(request, vm)
+		return nil, err
+	case action == "config" && request.method == "POST":
+		err = server.updateConfig(request, vm)
+		if err != nil {
+			return nil, err
+		}
+		return server.newTask(request, "qmconfig", strconv.FormatInt(id, 10)), nil
+	case len(path) > 1 && path[1] == "snapshot":
+		return server.handleSnapshots(request, vm, path[2:])
+	case action == "clone" && request.method == "POST":
+		return server.cloneVM(request, vm)
+	case action == "template" && request.method == "POST":
+		return server.convertToTemplate(request, vm)
+	case action == "cloudinit" && request.method == "PUT":
+		// The fake has no cloud-init image to regenerate
+		return nil, nil
+	case action == "status/current" && request.method == "GET":
+		return statusResponse(vm), nil
+	case strings.HasPrefix(action, "status/") && request.method == "POST":
+		return server.changeStatus(request, vm, strings.TrimPrefix(action, "status/"))
+	}
+
+	return nil, notImplemented(request.method, request.path)
+}
+
+func (server *Server) listVMs(node *node) []map[string]any {
+	ids := make([]int64, 0, len(node.vms))
+	for id := range node.vms {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	vms := make([]map[string]any, 0, len(ids))
+	for _, id := range ids {
+		vms = append(vms, statusResponse(node.vms[id]))
+	}
+	return vms
+}
+
+func (server *Server) createVM(request *request) (any, error) {
+	id, ok, err := intParam(request.params, "vmid")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"vmid": "property is missing and it is not optional"}}
+	}
+
+	for _, node := range server.nodes {
+		if _, exists := node.vms[id]; exists {
+			return nil, newError(http.StatusInternalServerError, "unable to create VM %d - VM %d already exists on node '%s'", id, id, node.name)
+		}
+	}
+
+	vm := &vm{
+		id:     id,
+		status: "stopped",
+		config: map[string]any{
+			"meta":    fmt.Sprintf("creation-qemu=8.1.2,ctime=%d", time.Now().Unix()),
+			"smbios1": "uuid=" + uuid(),
+			"vmgenid": uuid(),
+		},
+	}
+
+	delete(request.params, "vmid")
+	start := boolParam(request.params, "start")
+	delete(request.params, "start")
+
+	err = server.applyConfig(vm, request.params)
+	if err != nil {
+		return nil, err
+	}
+
+	request.node.vms[id] = vm
+
+	upid := server.newTask(request, "qmcreate", strconv.FormatInt(id, 10))
+	if start {
+		vm.status = "running"
+	}
+	return upid, nil
+}
+
+func (server *Server) cloneVM(request *request, source *vm) (any, error) {
+	id, ok, err := intParam(request.params, "newid")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"newid": "property is missing and it is not optional"}}
+	}
+
+	for _, node := range server.nodes {
+		if _, exists := node.vms[id]; exists {
+			return nil, newError(http.StatusInternalServerError, "unable to create VM %d: config file already exists", id)
+		}
+	}
+
+	target := request.node
+	if name, ok := stringParam(request.params, "target"); ok {
+		target, ok = server.nodes[name]
+		if !ok {
+			return nil, newError(http.StatusInternalServerError, "no such cluster node '%s'", name)
+		}
+	}
+
+	template := source.config["template"] == int64(1)
+	full := !template
+	if _, ok := request.params["full"]; ok {
+		full = boolParam(request.params, "full")
+	}
+
+	storage, _ := stringParam(request.params, "storage")
+	if !full {
+		if storage != "" {
+			return nil, newError(http.StatusInternalServerError, "parameter 'storage' not allowed for linked clones")
+		}
+		if !template {
+			return nil, newError(http.StatusInternalServerError, "linked clone of VM %d is only possible from a template", source.id)
+		}
+	}
+
+	config := source.config
+	if name, ok := stringParam(request.params, "snapname"); ok {
+		snapshot, ok := source.snapshots[name]
+		if !ok {
+			return nil, newError(http.StatusInternalServerError, "snapshot '%s' does not exist", name)
+		}
+		config = snapshot.config
+	}
+
+	// Snapshots are not cloned
+	clone := &vm{
+		id:     id,
+		status: "stopped",
+		config: maps.Clone(config),
+	}
+	delete(clone.config, "template")
+	delete(clone.config, "parent")
+	clone.config["meta"] = fmt.Sprintf("creation-qemu=8.1.2,ctime=%d", time.Now().Unix())
+	clone.config["smbios1"] = "uuid=" + uuid()
+	clone.config["vmgenid"] = uuid()
+
+	clone.config["name"] = "Copy-of-VM-" + fmt.Sprint(source.config["name"])
+	if name, ok := stringParam(request.params, "name"); ok {
+		clone.config["name"] = name
+	}
+	if description, ok := stringParam(request.params, "description"); ok {
+		clone.config["description"] = description
+	}
+
+	for key, value := range clone.config {
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		switch {
+		case diskKey.MatchString(key):
+			clone.config[key] = cloneDisk(clone, text, full, storage)
+		case netKey.MatchString(key):
+			clone.config[key] = replaceMAC(text)
+		case strings.HasPrefix(key, "unused"):
+			// Unused disks are not cloned
+			delete(clone.config, key)
+		}
+	}
+
+	target.vms[id] = clone
+
+	return server.newTask(request, "qmclone", strconv.FormatInt(source.id, 10)), nil
+}
+
+func (server *Server) convertToTemplate(request *request, vm *vm) (any, error) {
+	if vm.status != "stopped" {
+		return nil, newError(http.StatusInternalServerError, "you can't convert a VM to template if VM is running")
+	}
+
+	vm.config["template"] = int64(1)
+
+	// The disks of templates are renamed to base-ID-disk-N
+	prefix := "vm-" + strconv.FormatInt(vm.id, 10) + "-disk-"
+	for key, value := range vm.config {
+		text, ok := value.(string)
+		if ok && diskKey.MatchString(key) && !strings.Contains(text, "media=cdrom") {
+			vm.config[key] = strings.Replace(text, prefix, "base-"+strconv.FormatInt(vm.id, 10)+"-disk-", 1)
+		}
+	}
+
+	return server.newTask(request, "qmtemplate", strconv.FormatInt(vm.id, 10)), nil
+}
+
+func (server *Server) deleteVM(request *request, vm *vm) (any, error) {
+	if vm.status != "stopped" {
+		return nil, newError(http.StatusInternalServerError, "VM %d is running - destroy failed", vm.id)
+	}
+
+	if vm.config["protection"] == int64(1) {
+		return nil, newError(http.StatusInternalServerError, "can't remove VM %d - protection mode enabled", vm.id)
+	}
+
+	delete(request.node.vms, vm.id)
+
+	return server.newTask(request, "qmdestroy", strconv.FormatInt(vm.id, 10)), nil
+}
+
+func (server *Server) updateConfig(request *request, vm *vm) error {
+	params := maps.Clone(request.params)
+	delete(params, "vmid")
+
+	digest, _ := stringParam(params, "digest")
+	delete(params, "digest")
+	if digest != "" && digest != configDigest(vm.config) {
+		return newError(http.StatusInternalServerError, "detected modified configuration - file changed by other user? Try again.")
+	}
+
+	deleted, _ := stringParam(params, "delete")
+	delete(params, "delete")
+	for _, key := range strings.Split(deleted, ",") {
+		key = strings.TrimSpace(key)
+		detachDisk(vm, key)
+		delete(vm.config, key)
+	}
+
+	return server.applyConfig(vm, params)
+}
+
+// applyConfig stores the parameters in the configuration, allocating disks and generating MAC addresses like Proxmox
+func (server *Server) applyConfig(vm *vm, params map[string]any) error {
+	// Proxmox checks the parameters against its schema first, the fake only checks the minimum memory
+	if memory, ok := stringParam(params, "memory"); ok {
+		if size, err := strconv.ParseInt(memory, 10, 64); err == nil && size < 16 {
+			return &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"memory": "value must have a minimum value of 16"}}
+		}
+	}
+
+	for key, value := range params {
+		if value == nil {
+			continue
+		}
+
+		stored := configValue(value)
+
+		if text, ok := stored.(string); ok {
+			switch {
+			case diskKey.MatchString(key):
+				stored = allocateDisk(vm, key, text)
+			case netKey.MatchString(key):
+				stored = assignMAC(text)
+			}
+		}
+
+		vm.config[key] = stored
+	}
+
+	return nil
+}
+
+// allocateDisk replaces the STORAGE:SIZE syntax with the name of a newly allocated volume
+func allocateDisk(vm *vm, key string, value string) string {
+	volume, options, _ := strings.Cut(value, ",")
+	storage, size, found := strings.Cut(volume, ":")
+	if !found {
+		return value
+	}
+
+	if size == "cloudinit" {
+		return storage + ":vm-" + strconv.FormatInt(vm.id, 10) + "-cloudinit,media=cdrom"
+	}
+
+	if _, err := strconv.ParseFloat(size, 64); err != nil {
+		return value
+	}
+
+	name := storage + ":vm-" + strconv.FormatInt(vm.id, 10) + "-disk-" + strconv.Itoa(vm.disks)
+	vm.disks++
+
+	switch key {
+	case "efidisk0", "tpmstate0":
+		size = "4M"
+	default:
+		size += "G"
+	}
+
+	if options != "" {
+		name += "," + options
+	}
+	return name + ",size=" + size
+}
+
+// cloneDisk copies the disk to a new volume of the clone, or links to it for linked clones. CD-ROMs are shared and the
+// cloud-init drive is generated again.
+func cloneDisk(clone *vm, value string, full bool, storage string) string {
+	volume, options, _ := strings.Cut(value, ",")
+	source, path, found := strings.Cut(volume, ":")
+	if !found {
+		return value
+	}
+
+	if options != "" {
+		options = "," + options
+	}
+
+	if strings.HasSuffix(path, "-cloudinit") {
+		return source + ":vm-" + strconv.FormatInt(clone.id, 10) + "-cloudinit" + options
+	}
+	if strings.Contains(options, "media=cdrom") {
+		return value
+	}
+
+	name := "vm-" + strconv.FormatInt(clone.id, 10) + "-disk-" + strconv.Itoa(clone.disks)
+	clone.disks++
+
+	switch {
+	case !full:
+		name = path + "/" + name
+	case storage != "":
+		source = storage
+	}
+
+	return source + ":" + name + options
+}
+
+// detachDisk keeps the volume of a removed disk as an unused disk, the way Proxmox does
+func detachDisk(vm *vm, key string) {
+	value, ok := vm.config[key].(string)
+	if !ok || !diskKey.MatchString(key) || strings.Contains(value, "media=cdrom") {
+		return
+	}
+
+	volume, _, _ := strings.Cut(value, ",")
+	for i := 0; ; i++ {
+		unused := "unused" + strconv.Itoa(i)
+		if _, exists := vm.config[unused]; !exists {
+			vm.config[unused] = volume
+			return
+		}
+	}
+}
+
+// assignMAC replaces model=MODEL with MODEL=MAC, the form Proxmox stores network devices in
+func assignMAC(value string) string {
+	options := strings.Split(value, ",")
+	for i, option := range options {
+		key, model, _ := strings.Cut(option, "=")
+		if key == "model" {
+			options[i] = model + "=" + randomMAC()
+			return strings.Join(options, ",")
+		}
+		if slices.Contains(networkModels, key) && model == "" {
+			options[i] = key + "=" + randomMAC()
+			return strings.Join(options, ",")
+		}
+	}
+	return value
+}
+
+// replaceMAC gives a network device a new MAC address, the way Proxmox does for clones
+func replaceMAC(value string) string {
+	options := strings.Split(value, ",")
+	for i, option := range options {
+		key, _, _ := strings.Cut(option, "=")
+		if slices.Contains(networkModels, key) {
+			options[i] = key + "=" + randomMAC()
+			break
+		}
+	}
+	return strings.Join(options, ",")
+}
+
+func (server *Server) changeStatus(request *request, vm *vm, action string) (any, error) {
+	id := strconv.FormatInt(vm.id, 10)
+
+	if action != "start" && action != "stop" && vm.status != "running" {
+		return nil, newError(http.StatusInternalServerError, "VM %d not running", vm.id)
+	}
+
+	switch action {
+	case "start":
+		if vm.status == "running" {
+			return nil, newError(http.StatusInternalServerError, "VM %d already running", vm.id)
+		}
+		// Starting a hibernated VM restores its memory
+		if vm.config["lock"] == "suspended" {
+			delete(vm.config, "lock")
+			delete(vm.config, "vmstate")
+		}
+		vm.status = "running"
+		return server.newTask(request, "qmstart", id), nil
+	case "stop":
+		vm.status = "stopped"
+		vm.paused = false
+		return server.newTask(request, "qmstop", id), nil
+	case "shutdown":
+		if vm.paused && !boolParam(request.params, "forceStop") {
+			return nil, newError(http.StatusInternalServerError, "VM is paused - cannot shutdown")
+		}
+		vm.status = "stopped"
+		vm.paused = false
+		return server.newTask(request, "qmshutdown", id), nil
+	case "reboot":
+		vm.paused = false
+		return server.newTask(request, "qmreboot", id), nil
+	case "reset":
+		return server.newTask(request, "qmreset", id), nil
+	case "suspend":
+		if boolParam(request.params, "todisk") {
+			storage, ok := stringParam(request.params, "statestorage")
+			if !ok {
+				storage = "local-lvm"
+			}
+			vm.config["lock"] = "suspended"
+			vm.config["vmstate"] = storage + ":vm-" + id + "-state-suspend-" + time.Now().Format("2006-01-02")
+			vm.status = "stopped"
+			vm.paused = false
+		} else {
+			vm.paused = true
+		}
+		return server.newTask(request, "qmsuspend", id), nil
+	case "resume":
+		vm.paused = false
+		return server.newTask(request, "qmresume", id), nil
+	}
+
+	return nil, notImplemented(request.method, request.path)
+}
+
+func configResponse(vm *vm) map[string]any {
+	config := maps.Clone(vm.config)
+	config["digest"] = configDigest(vm.config)
+	// Proxmox never returns the cloud-init password
+	if _, ok := config["cipassword"]; ok {
+		config["cipassword"] = "**********"
+	}
+	return config
+}
+
+func statusResponse(vm *vm) map[string]any {
+	memory := int64(512)
+	if value, ok := vm.config["memory"].(int64); ok {
+		memory = value
+	}
+	cores := int64(1)
+	if value, ok := vm.config["cores"].(int64); ok {
+		cores = value
+	}
+	name, ok := vm.config["name"].(string)
+	if !ok {
+		name = "VM " + strconv.FormatInt(vm.id, 10)
+	}
+
+	qmpStatus := vm.status
+	if vm.paused {
+		qmpStatus = "paused"
+	}
+
+	status := map[string]any{
+		"vmid":      vm.id,
+		"name":      name,
+		"status":    vm.status,
+		"qmpstatus": qmpStatus,
+		"cpus":      cores,
+		"maxmem":    memory * 1024 * 1024,
+		"maxdisk":   0,
+		"uptime":    0,
+	}
+	if lock, ok := vm.config["lock"]; ok {
+		status["lock"] = lock
+	}
+	if vm.status == "running" {
+		status["pid"] = 4242
+		status["uptime"] = 1
+	}
+	return status
+}
+
+func configDigest(config map[string]any) string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha1.New()
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(hash, "%s: %v\n", key, config[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func uuid() string {
+	random := randomString()
+	return random[0:8] + "-" + random[8:12] + "-" + random[12:16] + "-" + random[16:20] + "-" + random[20:32]
+}
+
+// randomMAC returns a MAC address with the BC:24:11 prefix Proxmox uses
+func randomMAC() string {
+	random := strings.ToUpper(randomString())
+	return "BC:24:11:" + random[0:2] + ":" + random[2:4] + ":" + random[4:6]
+}
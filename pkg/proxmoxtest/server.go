@@ -0,0 +1,475 @@
+// Package proxmoxtest provides an in-process fake of the Proxmox VE API for tests.
+//
+// The fake keeps its state in memory and covers ticket and API token authentication, nodes, QEMU virtual machines,
+// tasks and node networks. Tasks finish as soon as they are created, unless RunTasks or HangTasks keeps them running.
+// Connect to it with the HTTP client of the server, which trusts its certificate:
+//
+//	server := proxmoxtest.NewServer()
+//	defer server.Close()
+//
+//	client, err := proxmox.NewClient(server.URL,
+//		proxmox.WithTicketAuth(proxmoxtest.DefaultUsername, proxmoxtest.DefaultPassword),
+//		proxmox.WithHTTPClient(server.Client()),
+//	)
+package proxmoxtest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The fake starts with one node and one user, matching the Vagrant boxes in vagrant/
+const (
+	DefaultNode     = "pve"
+	DefaultUsername = "root@pam"
+	DefaultPassword = "vagrant"
+)
+
+const apiPath = "/api2/json/"
+
+// Server is a fake Proxmox VE API served over TLS
+type Server struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	users    map[string]string
+	tokens   map[string]string
+	sessions map[string]session
+	nodes    map[string]*node
+	started  time.Time
+	pid      int64
+	// failures maps task types to the exit status their tasks fail with
+	failures map[string]string
+	// runs maps task types to how their tasks run, tasks of other types finish as soon as they are created
+	runs map[string]run
+	// requests counts the requests answered, not counting logins
+	requests int
+	// failing is the number of requests left to answer with failure
+	failing int
+	failure *apiError
+	inspect func(request *http.Request, params map[string]any)
+}
+
+type session struct {
+	user string
+	csrf string
+}
+
+type node struct {
+	name     string
+	vms      map[int64]*vm
+	networks map[string]map[string]any
+	tasks    []*task
+}
+
+// apiError is answered with its status and message, the same way Proxmox reports failures
+type apiError struct {
+	status  int
+	message string
+	errors  map[string]string
+}
+
+func (err *apiError) Error() string {
+	return err.message
+}
+
+func newError(status int, format string, args ...any) *apiError {
+	return &apiError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// request is a request that has been authenticated and routed
+type request struct {
+	method string
+	user   string
+	node   *node
+	// path holds the segments of the path after the node, e.g. ["qemu", "100", "config"]
+	path   []string
+	params map[string]any
+}
+
+// NewServer starts a fake with the node DefaultNode and the user DefaultUsername. Close it when done.
+func NewServer() *Server {
+	server := &Server{
+		users:    map[string]string{DefaultUsername: DefaultPassword},
+		tokens:   map[string]string{},
+		sessions: map[string]session{},
+		nodes:    map[string]*node{},
+		started:  time.Now(),
+		pid:      1000,
+	}
+	server.AddNode(DefaultNode)
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(server.serveHTTP))
+	return server
+}
+
+// AddUser adds a user that can log in for a ticket. The username includes the realm, for example admin@pve.
+func (server *Server) AddUser(username string, password string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.users[username] = password
+}
+
+// AddAPIToken adds an API token. The tokenID is the full identifier in the form user@realm!tokenid.
+func (server *Server) AddAPIToken(tokenID string, secret string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.tokens[tokenID] = secret
+}
+
+// AddNode adds a node with a vmbr0 bridge on the eth0 interface
+func (server *Server) AddNode(name string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.nodes[name] = &node{
+		name: name,
+		vms:  map[int64]*vm{},
+		networks: map[string]map[string]any{
+			"eth0": {"iface": "eth0", "type": "eth", "method": "manual", "families": []string{"inet"}, "active": 1, "exists": 1},
+			"vmbr0": {"iface": "vmbr0", "type": "bridge", "method": "static", "families": []string{"inet"}, "active": 1,
+				"autostart": 1, "bridge_ports": "eth0", "bridge_stp": "off", "bridge_fd": "0",
+				"address": "10.0.2.15", "netmask": "24", "cidr": "10.0.2.15/24", "gateway": "10.0.2.2"},
+		},
+	}
+}
+
+// ExpireTickets invalidates every ticket handed out so far, as if they had all expired
+func (server *Server) ExpireTickets() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.sessions = map[string]session{}
+}
+
+// FailRequests answers the next count requests, not counting logins, with the status and message instead, the way
+// Proxmox reports errors
+func (server *Server) FailRequests(count int, status int, message string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.failing = count
+	server.failure = newError(status, "%s", message)
+}
+
+// Requests returns the number of requests the fake has answered, not counting logins
+func (server *Server) Requests() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.requests
+}
+
+// OnRequest calls inspect with every request, logins included, and its parameters before the fake answers it.
+// The body of the request has already been read into the parameters. inspect must not call the methods of the server.
+func (server *Server) OnRequest(inspect func(request *http.Request, params map[string]any)) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.inspect = inspect
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of the certificate of the server in the format Proxmox uses
+func (server *Server) CertificateFingerprint() string {
+	fingerprint := sha256.Sum256(server.Certificate().Raw)
+	parts := make([]string, len(fingerprint))
+	for i, b := range fingerprint {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func (server *Server) serveHTTP(writer http.ResponseWriter, httpRequest *http.Request) {
+	data, err := server.handle(httpRequest)
+
+	writer.Header().Set("Content-Type", "application/json;charset=UTF-8")
+
+	if err != nil {
+		apiErr, ok := err.(*apiError)
+		if !ok {
+			apiErr = newError(http.StatusInternalServerError, "%s", err.Error())
+		}
+		writer.WriteHeader(apiErr.status)
+		_ = json.NewEncoder(writer).Encode(map[string]any{"data": nil, "message": apiErr.message + "\n", "errors": apiErr.errors})
+		return
+	}
+
+	_ = json.NewEncoder(writer).Encode(map[string]any{"data": data})
+}
+
+func (server *Server) handle(httpRequest *http.Request) (any, error) {
+	if !strings.HasPrefix(httpRequest.URL.Path, apiPath) {
+		return nil, newError(http.StatusNotFound, "Not Found")
+	}
+
+	params, err := readParams(httpRequest)
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "%s", err.Error())
+	}
+
+	path := strings.Split(strings.Trim(strings.TrimPrefix(httpRequest.URL.Path, apiPath), "/"), "/")
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.inspect != nil {
+		server.inspect(httpRequest, params)
+	}
+
+	if httpRequest.Method == "POST" && strings.Join(path, "/") == "access/ticket" {
+		return server.login(params)
+	}
+
+	server.requests++
+	if server.failing > 0 {
+		server.failing--
+		return nil, server.failure
+	}
+
+	user, err := server.authenticate(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if path[0] != "nodes" {
+		return nil, notImplemented(httpRequest.Method, path)
+	}
+
+	if len(path) == 1 {
+		if httpRequest.Method != "GET" {
+			return nil, notImplemented(httpRequest.Method, path)
+		}
+		return server.listNodes(), nil
+	}
+
+	node, ok := server.nodes[path[1]]
+	if !ok {
+		return nil, newError(http.StatusInternalServerError, "hostname lookup '%s' failed - failed to get address info for: %s: Name or service not known", path[1], path[1])
+	}
+
+	routed := &request{method: httpRequest.Method, user: user, node: node, path: path[2:], params: params}
+
+	if len(routed.path) > 0 {
+		switch routed.path[0] {
+		case "qemu":
+			return server.handleQemu(routed)
+		case "tasks":
+			return server.handleTasks(routed)
+		case "network":
+			return server.handleNetwork(routed)
+		}
+	}
+
+	return nil, notImplemented(httpRequest.Method, path)
+}
+
+func notImplemented(method string, path []string) *apiError {
+	return newError(http.StatusNotImplemented, "Method '%s /%s' not implemented", method, strings.Join(path, "/"))
+}
+
+// login hands out a ticket, Proxmox accepts the username and password as a form or as JSON
+func (server *Server) login(params map[string]any) (any, error) {
+	username, _ := stringParam(params, "username")
+	password, _ := stringParam(params, "password")
+
+	expected, ok := server.users[username]
+	if !ok || expected != password {
+		return nil, newError(http.StatusUnauthorized, "authentication failure")
+	}
+
+	timestamp := strings.ToUpper(strconv.FormatInt(time.Now().Unix(), 16))
+	ticket := "PVE:" + username + ":" + timestamp + "::" + randomString()
+	csrf := timestamp + ":" + randomString()
+	server.sessions[ticket] = session{user: username, csrf: csrf}
+
+	return map[string]any{
+		"username":            username,
+		"ticket":              ticket,
+		"CSRFPreventionToken": csrf,
+		"cap":                 map[string]any{},
+	}, nil
+}
+
+// authenticate checks the API token or the ticket and, for requests that change something, the CSRF token
+func (server *Server) authenticate(httpRequest *http.Request) (string, error) {
+	if authorization := httpRequest.Header.Get("Authorization"); authorization != "" {
+		token, found := strings.CutPrefix(authorization, "PVEAPIToken=")
+		if !found {
+			return "", newError(http.StatusUnauthorized, "invalid authorization header")
+		}
+		tokenID, secret, _ := strings.Cut(token, "=")
+		expected, ok := server.tokens[tokenID]
+		if !ok || expected != secret {
+			return "", newError(http.StatusUnauthorized, "invalid token value!")
+		}
+		return tokenID, nil
+	}
+
+	cookie, err := httpRequest.Cookie("PVEAuthCookie")
+	if err != nil {
+		return "", newError(http.StatusUnauthorized, "No ticket")
+	}
+
+	session, ok := server.sessions[cookie.Value]
+	if !ok {
+		return "", newError(http.StatusUnauthorized, "invalid PVE ticket")
+	}
+
+	if httpRequest.Method != "GET" && httpRequest.Header.Get("CSRFPreventionToken") != session.csrf {
+		return "", newError(http.StatusUnauthorized, "Permission check failed (invalid csrf token)")
+	}
+
+	return session.user, nil
+}
+
+func (server *Server) listNodes() []map[string]any {
+	nodes := make([]map[string]any, 0, len(server.nodes))
+	for _, node := range server.nodes {
+		nodes = append(nodes, map[string]any{
+			"node":            node.name,
+			"id":              "node/" + node.name,
+			"type":            "node",
+			"status":          "online",
+			"level":           "",
+			"uptime":          int64(time.Since(server.started).Seconds()) + 1,
+			"cpu":             0.01,
+			"maxcpu":          4,
+			"mem":             1 << 30,
+			"maxmem":          8 << 30,
+			"disk":            4 << 30,
+			"maxdisk":         64 << 30,
+			"ssl_fingerprint": server.CertificateFingerprint(),
+		})
+	}
+	return nodes
+}
+
+// readParams merges the query with a form or JSON body, the same way Proxmox accepts parameters
+func readParams(httpRequest *http.Request) (map[string]any, error) {
+	params := map[string]any{}
+	for key, values := range httpRequest.URL.Query() {
+		params[key] = values[0]
+	}
+
+	if httpRequest.Body == nil || httpRequest.ContentLength == 0 {
+		return params, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(httpRequest.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		body := map[string]any{}
+		decoder := json.NewDecoder(httpRequest.Body)
+		decoder.UseNumber()
+		err := decoder.Decode(&body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		for key, value := range body {
+			params[key] = value
+		}
+	default:
+		err := httpRequest.ParseForm()
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range httpRequest.PostForm {
+			params[key] = values[0]
+		}
+	}
+
+	return params, nil
+}
+
+// stringParam returns the parameter as a string, formatting numbers and booleans the way Proxmox stores them
+func stringParam(params map[string]any, key string) (string, bool) {
+	value, ok := params[key]
+	if !ok || value == nil {
+		return "", false
+	}
+
+	switch typed := value.(type) {
+	case string:
+		return typed, true
+	case bool:
+		if typed {
+			return "1", true
+		}
+		return "0", true
+	default:
+		return fmt.Sprint(typed), true
+	}
+}
+
+func intParam(params map[string]any, key string) (int64, bool, error) {
+	value, ok := stringParam(params, key)
+	if !ok {
+		return 0, false, nil
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, true, &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{key: "type check ('integer') failed - got '" + value + "'"}}
+	}
+
+	return number, true, nil
+}
+
+func boolParam(params map[string]any, key string) bool {
+	value, _ := stringParam(params, key)
+	return value == "1" || value == "true"
+}
+
+// configValue converts a parameter to the value Proxmox returns for it: integers as numbers and everything else,
+// including booleans as 0 and 1, as strings
+func configValue(value any) any {
+	switch typed := value.(type) {
+	case bool:
+		if typed {
+			return int64(1)
+		}
+		return int64(0)
+	case json.Number:
+		if integer, err := typed.Int64(); err == nil {
+			return integer
+		}
+		return typed.String()
+	default:
+		return fmt.Sprint(typed)
+	}
+}
+
+func randomString() string {
+	buffer := make([]byte, 16)
+	_, _ = rand.Read(buffer)
+	return hex.EncodeToString(buffer)
+}
+
+func parseID(value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"vmid": "type check ('integer') failed - got '" + value + "'"}}
+	}
+	return id, nil
+}
+
+// unescapePathSegment undoes the escaping some clients apply to UPIDs in the path
+func unescapePathSegment(segment string) string {
+	unescaped, err := url.PathUnescape(segment)
+	if err != nil {
+		return segment
+	}
+	return unescaped
+}
@@ -0,0 +1,230 @@
+package proxmoxtest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/clincha-org/proxmox-api/pkg/ide"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+	"github.com/clincha-org/proxmox-api/pkg/proxmox"
+	"github.com/clincha-org/proxmox-api/pkg/proxmoxtest"
+	"github.com/clincha-org/proxmox-api/pkg/scsi"
+)
+
+func TestAPIToken(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	defer server.Close()
+
+	server.AddAPIToken("root@pam!ci", "secret")
+
+	client, err := proxmox.NewClient(server.URL, proxmox.WithAPIToken("root@pam!ci", "secret"), proxmox.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err := client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 1 || nodes[0].Node != proxmoxtest.DefaultNode {
+		t.Errorf("Expected the node %s, got %+v", proxmoxtest.DefaultNode, nodes)
+	}
+
+	client, err = proxmox.NewClient(server.URL, proxmox.WithAPIToken("root@pam!ci", "wrong"), proxmox.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetNodes(context.Background())
+	if !proxmox.IsUnauthorized(err) {
+		t.Errorf("Expected the wrong secret to be rejected, got %v", err)
+	}
+}
+
+func TestExpireTickets(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	defer server.Close()
+
+	client, err := proxmox.NewClient(server.URL, proxmox.WithTicketAuth(proxmoxtest.DefaultUsername, proxmoxtest.DefaultPassword), proxmox.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticket := client.Ticket
+	server.ExpireTickets()
+
+	_, err = client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Ticket == ticket {
+		t.Error("Expected the client to log in again after the ticket expired")
+	}
+}
+
+func TestCSRFTokenRequired(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	defer server.Close()
+
+	client, err := proxmox.NewClient(server.URL, proxmox.WithTicketAuth(proxmoxtest.DefaultUsername, proxmoxtest.DefaultPassword), proxmox.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := http.NewRequest("POST", server.URL+proxmox.ApiPath+"nodes/pve/network", strings.NewReader("iface=vmbr1&type=bridge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: client.Ticket.Data.Ticket})
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a change without the CSRF token to be rejected, got %d", response.StatusCode)
+	}
+}
+
+func TestFailTasks(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	defer server.Close()
+
+	client, err := proxmox.NewClient(server.URL, proxmox.WithTicketAuth(proxmoxtest.DefaultUsername, proxmoxtest.DefaultPassword), proxmox.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.FailTasks("qmcreate", "unable to create VM 100")
+
+	cores := int64(1)
+	memory := int64(512)
+	_, err = client.CreateVM(context.Background(), proxmoxtest.DefaultNode, &proxmox.VirtualMachine{ID: 100, IDEDevices: &[]ide.InternalDataStorage{}, Cores: &cores, Memory: &memory}, false)
+
+	var taskErr *proxmox.TaskError
+	if !errors.As(err, &taskErr) {
+		t.Fatalf("Expected a TaskError, got %v", err)
+	}
+
+	if taskErr.ExitStatus != "unable to create VM 100" {
+		t.Errorf("Expected the exit status of the failed task, got %q", taskErr.ExitStatus)
+	}
+}
+
+func TestRunTasks(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	defer server.Close()
+
+	client, err := proxmox.NewClient(server.URL, proxmox.WithTicketAuth(proxmoxtest.DefaultUsername, proxmoxtest.DefaultPassword), proxmox.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cores := int64(1)
+	memory := int64(512)
+	_, err = client.CreateVM(context.Background(), proxmoxtest.DefaultNode, &proxmox.VirtualMachine{ID: 100, IDEDevices: &[]ide.InternalDataStorage{}, Cores: &cores, Memory: &memory}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.RunTasks("qmstart", "starting VM 100")
+
+	upid, err := client.StartVM(context.Background(), proxmoxtest.DefaultNode, 100, proxmox.PowerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := client.GetTask(context.Background(), upid)
+	if err != nil || !task.Running() {
+		t.Fatalf("Expected the task to be running while it writes its log, got %+v and %v", task, err)
+	}
+
+	task, err = client.GetTask(context.Background(), upid)
+	if err != nil || !task.Succeeded() {
+		t.Fatalf("Expected the task to have finished, got %+v and %v", task, err)
+	}
+
+	log, err := client.GetTaskLog(context.Background(), upid, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 2 || log[0].Text != "starting VM 100" || log[1].Text != "TASK OK" {
+		t.Errorf("Expected the log lines followed by TASK OK, got %+v", log)
+	}
+}
+
+func TestFailRequests(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	defer server.Close()
+
+	client, err := proxmox.NewClient(server.URL, proxmox.WithTicketAuth(proxmoxtest.DefaultUsername, proxmoxtest.DefaultPassword), proxmox.WithHTTPClient(server.Client()), proxmox.WithRetryPolicy(proxmox.RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.FailRequests(1, http.StatusInternalServerError, "VM is locked (backup)")
+
+	_, err = client.GetNodes(context.Background())
+	if !proxmox.IsLocked(err) {
+		t.Errorf("Expected the injected failure, got %v", err)
+	}
+
+	_, err = client.GetNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Requests() != 2 {
+		t.Errorf("Expected 2 requests besides the login, got %d", server.Requests())
+	}
+}
+
+func TestVMLifecycle(t *testing.T) {
+	server := proxmoxtest.NewServer()
+	defer server.Close()
+
+	client, err := proxmox.NewClient(server.URL, proxmox.WithTicketAuth(proxmoxtest.DefaultUsername, proxmoxtest.DefaultPassword), proxmox.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diskSize := 8 * propstring.Gibibyte
+	scsi1 := scsi.Disk{ID: 1, Storage: "local-lvm", Size: &diskSize}
+	cores := int64(1)
+	memory := int64(512)
+	_, err = client.CreateVM(context.Background(), proxmoxtest.DefaultNode, &proxmox.VirtualMachine{ID: 100, IDEDevices: &[]ide.InternalDataStorage{}, SCSIDevices: &[]scsi.Disk{scsi1}, Cores: &cores, Memory: &memory}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, ok := server.VMConfig(proxmoxtest.DefaultNode, 100)
+	if !ok {
+		t.Fatal("Expected the VM to exist")
+	}
+	if config["scsi1"] != "local-lvm:vm-100-disk-0,size=8G" {
+		t.Errorf("Expected a disk to be allocated, got %v", config["scsi1"])
+	}
+
+	status, _ := server.VMStatus(proxmoxtest.DefaultNode, 100)
+	if status != "running" {
+		t.Errorf("Expected the VM to be running, got %q", status)
+	}
+
+	err = client.DeleteVM(context.Background(), proxmoxtest.DefaultNode, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetVM(context.Background(), proxmoxtest.DefaultNode, 100)
+	if !proxmox.IsNotFound(err) {
+		t.Errorf("Expected the VM to be gone, got %v", err)
+	}
+}
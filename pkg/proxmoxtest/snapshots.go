@@ -0,0 +1,171 @@
+package proxmoxtest
+
+import (
+	"maps"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// snapshotName is the format Proxmox allows for snapshot names
+var snapshotName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]+$`)
+
+type snapshot struct {
+	name        string
+	description string
+	parent      string
+	time        int64
+	vmstate     bool
+	config      map[string]any
+}
+
+func (server *Server) handleSnapshots(request *request, vm *vm, path []string) (any, error) {
+	id := strconv.FormatInt(vm.id, 10)
+
+	if len(path) == 0 {
+		switch request.method {
+		case "GET":
+			return listSnapshots(vm), nil
+		case "POST":
+			err := createSnapshot(vm, request.params)
+			if err != nil {
+				return nil, err
+			}
+			return server.newTask(request, "qmsnapshot", id), nil
+		}
+		return nil, notImplemented(request.method, request.path)
+	}
+
+	snapshot, ok := vm.snapshots[path[0]]
+	if !ok {
+		return nil, newError(http.StatusInternalServerError, "snapshot '%s' does not exist", path[0])
+	}
+
+	action := ""
+	if len(path) > 1 {
+		action = path[1]
+	}
+
+	switch {
+	case action == "" && request.method == "DELETE":
+		deleteSnapshot(vm, snapshot)
+		return server.newTask(request, "qmdelsnapshot", id), nil
+	case action == "rollback" && request.method == "POST":
+		rollbackSnapshot(vm, snapshot)
+		return server.newTask(request, "qmrollback", id), nil
+	case action == "config" && request.method == "GET":
+		return snapshotResponse(snapshot), nil
+	case action == "config" && request.method == "PUT":
+		if description, ok := stringParam(request.params, "description"); ok {
+			snapshot.description = description
+		}
+		return nil, nil
+	}
+
+	return nil, notImplemented(request.method, request.path)
+}
+
+func listSnapshots(vm *vm) []map[string]any {
+	snapshots := []map[string]any{}
+	for _, snapshot := range vm.snapshots {
+		snapshots = append(snapshots, snapshotResponse(snapshot))
+	}
+
+	running := int64(0)
+	if vm.status == "running" {
+		running = 1
+	}
+
+	// Proxmox lists the current state of the VM as a snapshot called current
+	current := map[string]any{
+		"name":        "current",
+		"description": "You are here!",
+		"running":     running,
+		"digest":      configDigest(vm.config),
+	}
+	if parent, ok := vm.config["parent"]; ok {
+		current["parent"] = parent
+	}
+
+	return append(snapshots, current)
+}
+
+func snapshotResponse(snapshot *snapshot) map[string]any {
+	response := map[string]any{
+		"name":        snapshot.name,
+		"description": snapshot.description,
+		"snaptime":    snapshot.time,
+	}
+	if snapshot.parent != "" {
+		response["parent"] = snapshot.parent
+	}
+	if snapshot.vmstate {
+		response["vmstate"] = int64(1)
+	}
+	return response
+}
+
+func createSnapshot(vm *vm, params map[string]any) error {
+	name, ok := stringParam(params, "snapname")
+	if !ok {
+		return &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"snapname": "property is missing and it is not optional"}}
+	}
+	if !snapshotName.MatchString(name) || name == "current" || len(name) > 40 {
+		return &apiError{status: http.StatusBadRequest, message: "Parameter verification failed.", errors: map[string]string{"snapname": "invalid format - invalid configuration ID '" + name + "'"}}
+	}
+	if _, exists := vm.snapshots[name]; exists {
+		return newError(http.StatusInternalServerError, "snapshot name '%s' already used", name)
+	}
+
+	description, _ := stringParam(params, "description")
+	parent, _ := vm.config["parent"].(string)
+
+	config := maps.Clone(vm.config)
+	delete(config, "parent")
+
+	if vm.snapshots == nil {
+		vm.snapshots = map[string]*snapshot{}
+	}
+	vm.snapshots[name] = &snapshot{
+		name:        name,
+		description: description,
+		parent:      parent,
+		time:        time.Now().Unix(),
+		// The memory can only be saved while the VM is running
+		vmstate: boolParam(params, "vmstate") && vm.status == "running",
+		config:  config,
+	}
+	vm.config["parent"] = name
+
+	return nil
+}
+
+// rollbackSnapshot restores the configuration of the snapshot. The VM keeps running only when its memory was saved.
+func rollbackSnapshot(vm *vm, snapshot *snapshot) {
+	vm.config = maps.Clone(snapshot.config)
+	vm.config["parent"] = snapshot.name
+
+	vm.status = "stopped"
+	if snapshot.vmstate {
+		vm.status = "running"
+	}
+}
+
+// deleteSnapshot removes the snapshot, its children become children of its parent
+func deleteSnapshot(vm *vm, deleted *snapshot) {
+	for _, snapshot := range vm.snapshots {
+		if snapshot.parent == deleted.name {
+			snapshot.parent = deleted.parent
+		}
+	}
+
+	if vm.config["parent"] == deleted.name {
+		delete(vm.config, "parent")
+		if deleted.parent != "" {
+			vm.config["parent"] = deleted.parent
+		}
+	}
+
+	delete(vm.snapshots, deleted.name)
+}
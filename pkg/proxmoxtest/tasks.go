@@ -0,0 +1,313 @@
+package proxmoxtest
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type task struct {
+	upid       string
+	node       string
+	pid        int64
+	pstart     int64
+	taskType   string
+	id         string
+	user       string
+	startTime  int64
+	endTime    int64
+	exitStatus string
+	log        []string
+	// running tasks write the pending log lines, one each time their status is polled, and then finish with result
+	running bool
+	pending []string
+	hang    bool
+	result  string
+}
+
+// run is how the tasks of a type run, see RunTasks and HangTasks
+type run struct {
+	log  []string
+	hang bool
+}
+
+// stoppedExitStatus is the exit status of a task that was stopped while running
+const stoppedExitStatus = "interrupted by signal"
+
+// FailTasks makes every following task of the given type, for example qmstart, fail with the exit status. An exit
+// status such as "WARNINGS: 1" finishes the tasks with warnings instead.
+func (server *Server) FailTasks(taskType string, exitStatus string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.failures == nil {
+		server.failures = map[string]string{}
+	}
+	server.failures[taskType] = exitStatus
+}
+
+// RunTasks keeps every following task of the given type running while it writes the log lines, one line each time
+// its status is polled, before it finishes. Stopping the task ends it early with the exit status "interrupted by
+// signal".
+func (server *Server) RunTasks(taskType string, log ...string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.runs == nil {
+		server.runs = map[string]run{}
+	}
+	server.runs[taskType] = run{log: log}
+}
+
+// HangTasks keeps every following task of the given type running until it is stopped
+func (server *Server) HangTasks(taskType string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.runs == nil {
+		server.runs = map[string]run{}
+	}
+	server.runs[taskType] = run{hang: true}
+}
+
+// newTask records a task, which has already finished unless RunTasks or HangTasks says otherwise, and returns its UPID
+func (server *Server) newTask(request *request, taskType string, id string) string {
+	server.pid++
+
+	now := time.Now().Unix()
+	task := &task{
+		node:      request.node.name,
+		pid:       server.pid,
+		pstart:    server.pid * 10,
+		taskType:  taskType,
+		id:        id,
+		user:      request.user,
+		startTime: now,
+		result:    "OK",
+	}
+	task.upid = fmt.Sprintf("UPID:%s:%08X:%08X:%08X:%s:%s:%s:", task.node, task.pid, task.pstart, task.startTime, task.taskType, task.id, task.user)
+
+	if exitStatus, ok := server.failures[taskType]; ok {
+		task.result = exitStatus
+	}
+
+	if run, ok := server.runs[taskType]; ok {
+		task.running = true
+		task.pending = slices.Clone(run.log)
+		task.hang = run.hang
+	} else {
+		task.finish(task.result)
+	}
+
+	request.node.tasks = append(request.node.tasks, task)
+	return task.upid
+}
+
+// finish stops the task with the exit status and writes the last line of its log the way Proxmox does
+func (task *task) finish(exitStatus string) {
+	task.running = false
+	task.endTime = time.Now().Unix()
+	task.exitStatus = exitStatus
+
+	switch {
+	case exitStatus == "OK":
+		task.log = append(task.log, "TASK OK")
+	case strings.HasPrefix(exitStatus, "WARNINGS"):
+		task.log = append(task.log, "TASK "+exitStatus)
+	default:
+		task.log = append(task.log, "TASK ERROR: "+exitStatus)
+	}
+}
+
+// poll lets a running task write its next log line, or finish once it has written them all
+func (task *task) poll() {
+	switch {
+	case !task.running || task.hang:
+	case len(task.pending) > 0:
+		task.log = append(task.log, task.pending[0])
+		task.pending = task.pending[1:]
+	default:
+		task.finish(task.result)
+	}
+}
+
+func (server *Server) handleTasks(request *request) (any, error) {
+	path := request.path[1:]
+
+	if len(path) == 0 {
+		if request.method == "GET" {
+			return listTasks(request)
+		}
+		return nil, notImplemented(request.method, request.path)
+	}
+
+	upid := unescapePathSegment(path[0])
+
+	var found *task
+	for _, task := range request.node.tasks {
+		if task.upid == upid {
+			found = task
+		}
+	}
+	if found == nil {
+		return nil, newError(http.StatusInternalServerError, "no such task")
+	}
+
+	action := strings.Join(path[1:], "/")
+	switch {
+	case action == "" && request.method == "DELETE":
+		if found.running {
+			found.finish(stoppedExitStatus)
+		}
+		return nil, nil
+	case action == "status" && request.method == "GET":
+		found.poll()
+		return taskStatus(found), nil
+	case action == "log" && request.method == "GET":
+		return taskLog(request, found)
+	}
+
+	return nil, notImplemented(request.method, request.path)
+}
+
+func listTasks(request *request) (any, error) {
+	vmid, _ := stringParam(request.params, "vmid")
+	taskType, _ := stringParam(request.params, "typefilter")
+	user, _ := stringParam(request.params, "userfilter")
+	source, _ := stringParam(request.params, "source")
+	statuses, _ := stringParam(request.params, "statusfilter")
+	errorsOnly := boolParam(request.params, "errors")
+
+	since, _, err := intParam(request.params, "since")
+	if err != nil {
+		return nil, err
+	}
+	until, _, err := intParam(request.params, "until")
+	if err != nil {
+		return nil, err
+	}
+	start, _, err := intParam(request.params, "start")
+	if err != nil {
+		return nil, err
+	}
+	limit, ok, err := intParam(request.params, "limit")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		limit = 50
+	}
+
+	tasks := []map[string]any{}
+	// Proxmox lists the most recent tasks first
+	for i := len(request.node.tasks) - 1; i >= 0; i-- {
+		task := request.node.tasks[i]
+
+		switch {
+		case task.running && source != "active" && source != "all":
+			continue
+		case !task.running && source == "active":
+			continue
+		case vmid != "" && task.id != vmid:
+			continue
+		case taskType != "" && task.taskType != taskType:
+			continue
+		case user != "" && !strings.Contains(task.user, user):
+			continue
+		case errorsOnly && (task.running || task.exitStatus == "OK"):
+			continue
+		case statuses != "" && !strings.Contains(","+statuses+",", ","+statusCategory(task.exitStatus)+","):
+			continue
+		case since != 0 && task.startTime < since:
+			continue
+		case until != 0 && task.startTime > until:
+			continue
+		}
+
+		listed := map[string]any{
+			"upid":      task.upid,
+			"node":      task.node,
+			"pid":       task.pid,
+			"pstart":    task.pstart,
+			"starttime": task.startTime,
+			"type":      task.taskType,
+			"id":        task.id,
+			"user":      task.user,
+		}
+		// Running tasks have neither an end time nor an exit status yet
+		if !task.running {
+			listed["endtime"] = task.endTime
+			listed["status"] = task.exitStatus
+		}
+		tasks = append(tasks, listed)
+	}
+
+	if start >= int64(len(tasks)) {
+		return []map[string]any{}, nil
+	}
+	tasks = tasks[start:]
+	if limit < int64(len(tasks)) {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
+}
+
+// statusCategory returns the category of an exit status used by the statusfilter parameter
+func statusCategory(exitStatus string) string {
+	switch {
+	case exitStatus == "OK":
+		return "ok"
+	case strings.HasPrefix(exitStatus, "WARNINGS"):
+		return "warning"
+	case exitStatus == "":
+		return "unknown"
+	default:
+		return "error"
+	}
+}
+
+func taskStatus(task *task) map[string]any {
+	status := map[string]any{
+		"upid":      task.upid,
+		"node":      task.node,
+		"pid":       task.pid,
+		"pstart":    task.pstart,
+		"starttime": task.startTime,
+		"type":      task.taskType,
+		"id":        task.id,
+		"user":      task.user,
+		"status":    "running",
+	}
+	if !task.running {
+		status["status"] = "stopped"
+		status["exitstatus"] = task.exitStatus
+	}
+	return status
+}
+
+func taskLog(request *request, task *task) (any, error) {
+	start, _, err := intParam(request.params, "start")
+	if err != nil {
+		return nil, err
+	}
+	limit, ok, err := intParam(request.params, "limit")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		limit = 50
+	}
+
+	// Proxmox answers with a single "no content" line while the log is still empty
+	if len(task.log) == 0 {
+		return []map[string]any{{"n": 1, "t": "no content"}}, nil
+	}
+
+	lines := []map[string]any{}
+	for i := start; i < int64(len(task.log)) && i < start+limit; i++ {
+		lines = append(lines, map[string]any{"n": i + 1, "t": task.log[i]})
+	}
+	return lines, nil
+}
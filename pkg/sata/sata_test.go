@@ -0,0 +1,66 @@
+package sata
+
+import (
+	"testing"
+)
+
+func TestSataRoundTrip(t *testing.T) {
+	data := "local-lvm:vm-100-disk-2,backup=0,size=4G,ssd=1"
+
+	device := &Disk{}
+	err := Unmarshal(5, data, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if device.ID != 5 || *device.Backup || !*device.SSD {
+		t.Errorf("Expected sata5 without backups on an SSD, got %+v", device)
+	}
+
+	marshalled, err := Marshal(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != data {
+		t.Errorf("Expected %q, got %q", data, marshalled)
+	}
+}
+
+func TestSataRoundTripExtra(t *testing.T) {
+	data := "local-lvm:vm-100-disk-2,iothread=1,ro=1,size=4G"
+
+	device := &Disk{}
+	err := Unmarshal(0, data, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if device.Extra["iothread"] != "1" || device.Extra["ro"] != "1" {
+		t.Errorf("Expected the options SATA does not cover to be kept, got %v", device.Extra)
+	}
+
+	marshalled, err := Marshal(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Options the model does not cover are written after the ones it does
+	expected := "local-lvm:vm-100-disk-2,size=4G,iothread=1,ro=1"
+	if marshalled != expected {
+		t.Errorf("Expected %q, got %q", expected, marshalled)
+	}
+}
+
+func TestSataMarshalInvalid(t *testing.T) {
+	path := "vm-100-disk-0"
+	_, err := Marshal(&Disk{ID: 6, Storage: "local-lvm", Path: &path})
+	if err == nil {
+		t.Error("Expected an error for sata6")
+	}
+
+	_, err = Marshal(&Disk{ID: 0, Path: &path})
+	if err == nil {
+		t.Error("Expected an error for a disk without a storage")
+	}
+}
@@ -0,0 +1,93 @@
+package scsi
+
+import (
+	"fmt"
+	"github.com/clincha-org/proxmox-api/pkg/internal/disk"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+)
+
+// properties is the property string Proxmox uses for SCSI disks, in the order Proxmox writes the options
+type properties struct {
+	File      string            `prop:"file,default"`
+	Backup    *bool             `prop:"backup"`
+	Cache     *string           `prop:"cache,enum=none|writethrough|writeback|unsafe|directsync"`
+	Discard   *string           `prop:"discard,enum=on|ignore"`
+	Format    *string           `prop:"format,enum=raw|qcow2|vmdk|cloop|cow|qcow|qed|vpc"`
+	IOThread  *bool             `prop:"iothread"`
+	Media     *string           `prop:"media,enum=cdrom|disk"`
+	Replicate *bool             `prop:"replicate"`
+	ReadOnly  *bool             `prop:"ro"`
+	Size      *propstring.Size  `prop:"size"`
+	SSD       *bool             `prop:"ssd"`
+	Extra     map[string]string `prop:",extra"`
+}
+
+func Unmarshal(id int64, data string, device *Disk) error {
+	if data == "" {
+		return nil
+	}
+
+	options := properties{}
+	err := propstring.Unmarshal(data, &options)
+	if err != nil {
+		return fmt.Errorf("invalid SCSI disk %v: %w", id, err)
+	}
+
+	device.ID = id
+	device.Storage, device.Path = disk.SplitFile(options.File)
+	device.Size = options.Size
+	device.Format = options.Format
+	device.Cache = options.Cache
+	device.Discard = disk.Discard(options.Discard)
+	device.IOThread = options.IOThread
+	device.SSD = options.SSD
+	device.ReadOnly = options.ReadOnly
+	device.Backup = options.Backup
+	device.Replicate = options.Replicate
+	device.Media = options.Media
+	device.Extra = options.Extra
+
+	return nil
+}
+
+func Marshal(device *Disk) (string, error) {
+
+	if device == nil {
+		return "", fmt.Errorf("cannot marshal nil Disk object")
+	}
+
+	if device.ID < 0 || device.ID > MaxID {
+		return "", fmt.Errorf("invalid ID for SCSI disk: %v", device.ID)
+	}
+
+	file, allocate, err := disk.File(device.Storage, device.Path, device.Size)
+	if err != nil {
+		return "", fmt.Errorf("invalid SCSI disk %v: %w", device.ID, err)
+	}
+
+	options := properties{
+		File:      file,
+		Format:    device.Format,
+		Cache:     device.Cache,
+		Discard:   disk.DiscardOption(device.Discard),
+		IOThread:  device.IOThread,
+		SSD:       device.SSD,
+		ReadOnly:  device.ReadOnly,
+		Backup:    device.Backup,
+		Replicate: device.Replicate,
+		Media:     device.Media,
+		Extra:     device.Extra,
+	}
+
+	// The size of a new volume is part of the file
+	if !allocate {
+		options.Size = device.Size
+	}
+
+	data, err := propstring.Marshal(options)
+	if err != nil {
+		return "", fmt.Errorf("invalid SCSI disk %v: %w", device.ID, err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,29 @@
+package scsi
+
+import (
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+)
+
+// MaxID is the highest SCSI disk number, VMs have scsi0 to scsi30
+const MaxID = 30
+
+// Disk is a SCSI disk of a VM, the scsiN setting
+type Disk struct {
+	ID      int64
+	Storage string
+	// Path is the volume on the storage. Leave it nil and set Size to allocate a new volume.
+	Path *string
+	// Size of the disk, new volumes are allocated in whole GiB. Changing it does not resize an existing disk.
+	Size      *propstring.Size
+	Format    *string // raw, qcow2 or vmdk
+	Cache     *string // none, writethrough, writeback, unsafe or directsync
+	Discard   *bool
+	IOThread  *bool // Requires the virtio-scsi-single controller
+	SSD       *bool
+	ReadOnly  *bool
+	Backup    *bool
+	Replicate *bool
+	Media     *string // cdrom or disk
+	// Extra holds the options this model does not cover, so they survive a round trip
+	Extra map[string]string
+}
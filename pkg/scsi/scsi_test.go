@@ -0,0 +1,81 @@
+package scsi
+
+import (
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+	"testing"
+)
+
+func TestScsiUnmarshal(t *testing.T) {
+	device := &Disk{}
+	err := Unmarshal(0, "local-lvm:vm-100-disk-0,backup=0,cache=writeback,discard=on,iothread=1,replicate=0,size=32G,ssd=1", device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if device.Storage != "local-lvm" || *device.Path != "vm-100-disk-0" {
+		t.Errorf("Expected local-lvm:vm-100-disk-0, got %s:%v", device.Storage, device.Path)
+	}
+
+	if *device.Size != 32*propstring.Gibibyte {
+		t.Errorf("Expected 32G, got %v", device.Size)
+	}
+
+	if *device.Cache != "writeback" || !*device.Discard || !*device.IOThread || !*device.SSD || *device.Backup || *device.Replicate {
+		t.Errorf("Expected the options to be read, got %+v", device)
+	}
+}
+
+func TestScsiRoundTrip(t *testing.T) {
+	tests := []string{
+		"local-lvm:vm-100-disk-0,discard=ignore,size=8G",
+		"local:100/vm-100-disk-1.qcow2,aio=native,format=qcow2,ro=1,size=2G",
+		"local:iso/ubuntu-24.04.1-live-server-amd64.iso,media=cdrom,size=2690412K",
+	}
+
+	for _, data := range tests {
+		device := &Disk{}
+		err := Unmarshal(1, data, device)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		marshalled, err := Marshal(device)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Options the model does not cover are written after the ones it does
+		if data == tests[1] {
+			data = "local:100/vm-100-disk-1.qcow2,format=qcow2,ro=1,size=2G,aio=native"
+		}
+
+		if marshalled != data {
+			t.Errorf("Expected %q, got %q", data, marshalled)
+		}
+	}
+}
+
+func TestScsiMarshalAllocation(t *testing.T) {
+	size := 8 * propstring.Gibibyte
+	iothread := true
+	marshalled, err := Marshal(&Disk{ID: 0, Storage: "local-lvm", Size: &size, IOThread: &iothread})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != "local-lvm:8,iothread=1" {
+		t.Errorf("Expected local-lvm:8,iothread=1, got %q", marshalled)
+	}
+}
+
+func TestScsiMarshalInvalid(t *testing.T) {
+	_, err := Marshal(&Disk{ID: 31, Storage: "local-lvm"})
+	if err == nil {
+		t.Error("Expected an error for scsi31")
+	}
+
+	_, err = Marshal(&Disk{ID: 0, Storage: "local-lvm"})
+	if err == nil {
+		t.Error("Expected an error for a disk without a path or size")
+	}
+}
@@ -0,0 +1,65 @@
+package tpmstate
+
+import (
+	"fmt"
+	"github.com/clincha-org/proxmox-api/pkg/internal/disk"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+)
+
+// properties is the property string Proxmox uses for the TPM state
+type properties struct {
+	File    string            `prop:"file,default"`
+	Size    *propstring.Size  `prop:"size"`
+	Version *string           `prop:"version,enum=v1.2|v2.0"`
+	Extra   map[string]string `prop:",extra"`
+}
+
+func Unmarshal(data string, state *State) error {
+	if data == "" {
+		return nil
+	}
+
+	parsed := properties{}
+	err := propstring.Unmarshal(data, &parsed)
+	if err != nil {
+		return fmt.Errorf("invalid TPM state: %w", err)
+	}
+
+	state.Storage, state.Path = disk.SplitFile(parsed.File)
+	state.Version = parsed.Version
+	state.Size = parsed.Size
+	state.Extra = parsed.Extra
+
+	return nil
+}
+
+func Marshal(state *State) (string, error) {
+
+	if state == nil {
+		return "", fmt.Errorf("cannot marshal nil State object")
+	}
+
+	if state.Storage == "" {
+		return "", fmt.Errorf("storage is required for the TPM state")
+	}
+
+	parsed := properties{
+		Version: state.Version,
+		Extra:   state.Extra,
+	}
+
+	// Proxmox picks the size of a new TPM state itself, the size in STORAGE:SIZE is ignored
+	if state.Path == nil {
+		parsed.File = state.Storage + ":1"
+	} else {
+		parsed.File = state.Storage + ":" + *state.Path
+		parsed.Size = state.Size
+	}
+
+	data, err := propstring.Marshal(parsed)
+	if err != nil {
+		return "", fmt.Errorf("invalid TPM state: %w", err)
+	}
+
+	return data, nil
+}
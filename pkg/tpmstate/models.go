@@ -0,0 +1,17 @@
+package tpmstate
+
+import (
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+)
+
+// State is the TPM state of a VM, the tpmstate0 setting. Windows 11 requires a TPM with version v2.0.
+type State struct {
+	Storage string
+	// Path is the volume on the storage. Leave it nil to allocate a new volume.
+	Path    *string
+	Version *string // v1.2 or v2.0
+	// Size is set by Proxmox, it is not used when allocating the volume
+	Size *propstring.Size
+	// Extra holds the options this model does not cover, so they survive a round trip
+	Extra map[string]string
+}
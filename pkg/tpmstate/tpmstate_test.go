@@ -0,0 +1,45 @@
+package tpmstate
+
+import (
+	"testing"
+)
+
+func TestTpmStateRoundTrip(t *testing.T) {
+	data := "local-lvm:vm-100-disk-2,size=4M,version=v2.0"
+
+	state := &State{}
+	err := Unmarshal(data, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Storage != "local-lvm" || *state.Path != "vm-100-disk-2" || *state.Version != "v2.0" {
+		t.Errorf("Expected a v2.0 TPM state, got %+v", state)
+	}
+
+	marshalled, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != data {
+		t.Errorf("Expected %q, got %q", data, marshalled)
+	}
+}
+
+func TestTpmStateMarshalAllocation(t *testing.T) {
+	version := "v2.0"
+	marshalled, err := Marshal(&State{Storage: "local-lvm", Version: &version})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != "local-lvm:1,version=v2.0" {
+		t.Errorf("Expected local-lvm:1,version=v2.0, got %q", marshalled)
+	}
+
+	_, err = Marshal(&State{Version: &version})
+	if err == nil {
+		t.Error("Expected an error for a TPM state without a storage")
+	}
+}
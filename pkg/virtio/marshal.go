@@ -0,0 +1,88 @@
+package virtio
+
+import (
+	"fmt"
+	"github.com/clincha-org/proxmox-api/pkg/internal/disk"
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+)
+
+// properties is the property string Proxmox uses for VirtIO disks, in the order Proxmox writes the options. Options the
+// model does not cover, such as ssd and media, are kept in Extra.
+type properties struct {
+	File      string            `prop:"file,default"`
+	Backup    *bool             `prop:"backup"`
+	Cache     *string           `prop:"cache,enum=none|writethrough|writeback|unsafe|directsync"`
+	Discard   *string           `prop:"discard,enum=on|ignore"`
+	Format    *string           `prop:"format,enum=raw|qcow2|vmdk|cloop|cow|qcow|qed|vpc"`
+	IOThread  *bool             `prop:"iothread"`
+	Replicate *bool             `prop:"replicate"`
+	ReadOnly  *bool             `prop:"ro"`
+	Size      *propstring.Size  `prop:"size"`
+	Extra     map[string]string `prop:",extra"`
+}
+
+func Unmarshal(id int64, data string, device *Disk) error {
+	if data == "" {
+		return nil
+	}
+
+	options := properties{}
+	err := propstring.Unmarshal(data, &options)
+	if err != nil {
+		return fmt.Errorf("invalid VirtIO disk %v: %w", id, err)
+	}
+
+	device.ID = id
+	device.Storage, device.Path = disk.SplitFile(options.File)
+	device.Size = options.Size
+	device.Format = options.Format
+	device.Cache = options.Cache
+	device.Discard = disk.Discard(options.Discard)
+	device.IOThread = options.IOThread
+	device.ReadOnly = options.ReadOnly
+	device.Backup = options.Backup
+	device.Replicate = options.Replicate
+	device.Extra = options.Extra
+
+	return nil
+}
+
+func Marshal(device *Disk) (string, error) {
+
+	if device == nil {
+		return "", fmt.Errorf("cannot marshal nil Disk object")
+	}
+
+	if device.ID < 0 || device.ID > MaxID {
+		return "", fmt.Errorf("invalid ID for VirtIO disk: %v", device.ID)
+	}
+
+	file, allocate, err := disk.File(device.Storage, device.Path, device.Size)
+	if err != nil {
+		return "", fmt.Errorf("invalid VirtIO disk %v: %w", device.ID, err)
+	}
+
+	options := properties{
+		File:      file,
+		Format:    device.Format,
+		Cache:     device.Cache,
+		Discard:   disk.DiscardOption(device.Discard),
+		IOThread:  device.IOThread,
+		ReadOnly:  device.ReadOnly,
+		Backup:    device.Backup,
+		Replicate: device.Replicate,
+		Extra:     device.Extra,
+	}
+
+	// The size of a new volume is part of the file
+	if !allocate {
+		options.Size = device.Size
+	}
+
+	data, err := propstring.Marshal(options)
+	if err != nil {
+		return "", fmt.Errorf("invalid VirtIO disk %v: %w", device.ID, err)
+	}
+
+	return data, nil
+}
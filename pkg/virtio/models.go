@@ -0,0 +1,27 @@
+package virtio
+
+import (
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+)
+
+// MaxID is the highest VirtIO disk number, VMs have virtio0 to virtio15
+const MaxID = 15
+
+// Disk is a VirtIO disk of a VM, the virtioN setting
+type Disk struct {
+	ID      int64
+	Storage string
+	// Path is the volume on the storage. Leave it nil and set Size to allocate a new volume.
+	Path *string
+	// Size of the disk, new volumes are allocated in whole GiB. Changing it does not resize an existing disk.
+	Size      *propstring.Size
+	Format    *string // raw, qcow2 or vmdk
+	Cache     *string // none, writethrough, writeback, unsafe or directsync
+	Discard   *bool
+	IOThread  *bool
+	ReadOnly  *bool
+	Backup    *bool
+	Replicate *bool
+	// Extra holds the options this model does not cover, so they survive a round trip
+	Extra map[string]string
+}
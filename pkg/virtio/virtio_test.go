@@ -0,0 +1,72 @@
+package virtio
+
+import (
+	"github.com/clincha-org/proxmox-api/pkg/propstring"
+	"testing"
+)
+
+func TestVirtioRoundTrip(t *testing.T) {
+	data := "local-lvm:vm-100-disk-1,cache=none,discard=on,iothread=1,size=16G"
+
+	device := &Disk{}
+	err := Unmarshal(3, data, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if device.ID != 3 || *device.Size != 16*propstring.Gibibyte || !*device.IOThread {
+		t.Errorf("Expected virtio3 with 16G and an IO thread, got %+v", device)
+	}
+
+	marshalled, err := Marshal(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != data {
+		t.Errorf("Expected %q, got %q", data, marshalled)
+	}
+}
+
+func TestVirtioRoundTripExtra(t *testing.T) {
+	data := "local-lvm:vm-100-disk-1,media=disk,size=16G,ssd=1"
+
+	device := &Disk{}
+	err := Unmarshal(0, data, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if device.Extra["media"] != "disk" || device.Extra["ssd"] != "1" {
+		t.Errorf("Expected the options VirtIO does not cover to be kept, got %v", device.Extra)
+	}
+
+	marshalled, err := Marshal(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Options the model does not cover are written after the ones it does
+	expected := "local-lvm:vm-100-disk-1,size=16G,media=disk,ssd=1"
+	if marshalled != expected {
+		t.Errorf("Expected %q, got %q", expected, marshalled)
+	}
+}
+
+func TestVirtioMarshalAllocation(t *testing.T) {
+	// New volumes are allocated in whole GiB
+	size := 1536 * propstring.Mebibyte
+	marshalled, err := Marshal(&Disk{ID: 15, Storage: "local-lvm", Size: &size})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marshalled != "local-lvm:2" {
+		t.Errorf("Expected local-lvm:2, got %q", marshalled)
+	}
+
+	_, err = Marshal(&Disk{ID: 16, Storage: "local-lvm", Size: &size})
+	if err == nil {
+		t.Error("Expected an error for virtio16")
+	}
+}